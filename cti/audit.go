@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rresender/csta-integration/cti/auth"
+	"github.com/rresender/csta-integration/cti/db"
+	"github.com/rresender/csta-integration/cti/provider"
+)
+
+const (
+	// auditBatch entries read from the stream at once
+	auditBatch = 500
+	// defaultAuditLimit of the entries returned by a query
+	defaultAuditLimit = 100
+	// maxAuditLimit of the entries returned by a query, the export is not limited
+	maxAuditLimit = 1000
+	// maxAuditScan entries read by a query before giving up on filling its limit
+	maxAuditScan = 100000
+)
+
+// systemIdentity of the actions triggered by the service itself
+var systemIdentity = &auth.Identity{Name: "system", Method: "internal"}
+
+// AuditEntry mutating action of the API or of the service with its caller and its result
+type AuditEntry struct {
+	ID        string            `json:"id,omitempty"`
+	Time      time.Time         `json:"time"`
+	Instance  string            `json:"instance"`
+	Actor     string            `json:"actor"`
+	Method    string            `json:"method"`
+	Remote    string            `json:"remote,omitempty"`
+	Forwarded string            `json:"forwardedFor,omitempty"`
+	Action    string            `json:"action"`
+	Switch    string            `json:"switch,omitempty"`
+	Extension string            `json:"extension,omitempty"`
+	Params    map[string]string `json:"params,omitempty"`
+	Result    string            `json:"result"`
+	Error     string            `json:"error,omitempty"`
+	CSTAError string            `json:"cstaError,omitempty"`
+}
+
+// recordAudit appends the action to the audit stream, a failure is logged without failing the action
+func recordAudit(identity *auth.Identity, remote string, forwarded string, action string, switchName string, extension string, params map[string]string, err error) {
+	entry := &AuditEntry{
+		Time:      time.Now().UTC(),
+		Instance:  instanceID,
+		Actor:     identity.Name,
+		Method:    identity.Method,
+		Remote:    remote,
+		Forwarded: forwarded,
+		Action:    action,
+		Switch:    switchName,
+		Extension: extension,
+		Params:    params,
+		Result:    "ok",
+	}
+	for k, v := range params {
+		if v == "" {
+			delete(entry.Params, k)
+		}
+	}
+	if err != nil {
+		entry.Result, entry.Error = "error", err.Error()
+		var cstaErr *provider.CSTAError
+		var sessionErr *provider.SessionError
+		switch {
+		case errors.As(err, &cstaErr):
+			entry.CSTAError = cstaErr.Category + "/" + cstaErr.Value
+		case errors.As(err, &sessionErr):
+			entry.CSTAError = sessionErr.Service + "/" + sessionErr.DefinedError
+		}
+	}
+	data, _ := json.Marshal(entry)
+	if _, err := db.AppendAudit(string(data)); err != nil {
+		log.Error("audit entry could not be recorded", "action", action, "actor", entry.Actor, "extension", extension, "error", err)
+	}
+}
+
+// auditRequest records the action of an API request for the identity of its client
+func auditRequest(r *http.Request, action string, switchName string, extension string, params map[string]string, err error) {
+	recordAudit(auth.FromContext(r.Context()), r.RemoteAddr, r.Header.Get("X-Forwarded-For"), action, switchName, extension, params, err)
+}
+
+// AuditQuery filters of the audit entries, empty filters match every entry
+type AuditQuery struct {
+	From      time.Time
+	To        time.Time
+	Actor     string
+	Action    string
+	Switch    string
+	Extension string
+	Result    string
+	Limit     int
+}
+
+func (q *AuditQuery) matches(e *AuditEntry) bool {
+	return (q.Actor == "" || q.Actor == e.Actor) &&
+		(q.Action == "" || q.Action == e.Action || strings.HasPrefix(e.Action, q.Action+".")) &&
+		(q.Switch == "" || q.Switch == e.Switch) &&
+		(q.Extension == "" || q.Extension == e.Extension) &&
+		(q.Result == "" || q.Result == e.Result)
+}
+
+// reloadParams of the audit entry of a reload of the configuration
+func reloadParams(reason string, reloads []*Reload) map[string]string {
+	params := map[string]string{"reason": reason}
+	for _, r := range reloads {
+		params[r.Switch] = fmt.Sprintf("started: %d, stopped: %d, restarted: %d, failed: %d",
+			len(r.Started), len(r.Stopped), len(r.Restarted), len(r.Failed))
+	}
+	return params
+}
+
+func parseAuditTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func parseAuditQuery(r *http.Request) (*AuditQuery, error) {
+	values := r.URL.Query()
+	q := &AuditQuery{
+		Actor:     values.Get("actor"),
+		Action:    values.Get("action"),
+		Switch:    values.Get("switch"),
+		Extension: values.Get("extension"),
+		Result:    values.Get("result"),
+		Limit:     defaultAuditLimit,
+	}
+	var err error
+	if q.From, err = parseAuditTime(values.Get("from")); err != nil {
+		return nil, fmt.Errorf("invalid from: %v", err)
+	}
+	if q.To, err = parseAuditTime(values.Get("to")); err != nil {
+		return nil, fmt.Errorf("invalid to: %v", err)
+	}
+	if v := values.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit <= 0 {
+			return nil, fmt.Errorf("invalid limit: %s", v)
+		}
+		if q.Limit > maxAuditLimit {
+			q.Limit = maxAuditLimit
+		}
+	}
+	return q, nil
+}
+
+// streamRange IDs of the period of the query, the IDs of a stream start with their time in milliseconds
+func (q *AuditQuery) streamRange() (string, string) {
+	start, end := "-", "+"
+	if !q.From.IsZero() {
+		start = strconv.FormatInt(q.From.UnixNano()/int64(time.Millisecond), 10)
+	}
+	if !q.To.IsZero() {
+		end = strconv.FormatInt(q.To.UnixNano()/int64(time.Millisecond), 10)
+	}
+	return start, end
+}
+
+// adjacentStreamID following or preceding an ID, to page through a stream without exclusive ranges
+func adjacentStreamID(ID string, next bool) string {
+	parts := strings.SplitN(ID, "-", 2)
+	ms, _ := strconv.ParseUint(parts[0], 10, 64)
+	var seq uint64
+	if len(parts) == 2 {
+		seq, _ = strconv.ParseUint(parts[1], 10, 64)
+	}
+	switch {
+	case next && seq == ^uint64(0):
+		ms, seq = ms+1, 0
+	case next:
+		seq++
+	case seq == 0:
+		ms, seq = ms-1, ^uint64(0)
+	default:
+		seq--
+	}
+	return fmt.Sprintf("%d-%d", ms, seq)
+}
+
+// scanAudit calls visit with the entries of the query, newest first when reverse, until it returns false
+// or, when maxScan is positive, maxScan entries have been read
+func scanAudit(q *AuditQuery, reverse bool, maxScan int, visit func(*AuditEntry) bool) error {
+	start, end := q.streamRange()
+	scanned := 0
+	for {
+		entries, err := db.ReadAudit(start, end, auditBatch, reverse)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if scanned++; maxScan > 0 && scanned > maxScan {
+				return nil
+			}
+			var entry AuditEntry
+			if err := json.Unmarshal([]byte(e.Value), &entry); err != nil {
+				log.Warn("audit entry could not be read", "id", e.ID, "error", err)
+				continue
+			}
+			entry.ID = e.ID
+			if q.matches(&entry) && !visit(&entry) {
+				return nil
+			}
+		}
+		if len(entries) < auditBatch {
+			return nil
+		}
+		last := entries[len(entries)-1].ID
+		if reverse {
+			end = adjacentStreamID(last, false)
+		} else {
+			start = adjacentStreamID(last, true)
+		}
+	}
+}
+
+// queryAudit entries of the query, newest first
+func queryAudit(q *AuditQuery) ([]*AuditEntry, error) {
+	entries := []*AuditEntry{}
+	err := scanAudit(q, true, maxAuditScan, func(e *AuditEntry) bool {
+		entries = append(entries, e)
+		return len(entries) < q.Limit
+	})
+	return entries, err
+}
+
+var auditColumns = []string{"id", "time", "instance", "actor", "method", "remote", "forwardedFor", "action", "switch", "extension", "params", "result", "error", "cstaError"}
+
+func auditRecord(e *AuditEntry) []string {
+	params := make([]string, 0, len(e.Params))
+	for k, v := range e.Params {
+		params = append(params, k+"="+v)
+	}
+	sort.Strings(params)
+	return []string{e.ID, e.Time.Format(time.RFC3339Nano), e.Instance, e.Actor, e.Method, e.Remote, e.Forwarded, e.Action,
+		e.Switch, e.Extension, strings.Join(params, ";"), e.Result, e.Error, e.CSTAError}
+}
+
+// exportAudit writes every entry of the query, oldest first, as CSV or newline delimited JSON
+func exportAudit(w http.ResponseWriter, q *AuditQuery, format string) {
+	var write func(*AuditEntry) error
+	var flush func() error
+	switch format {
+	case "", "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", "attachment; filename=\"audit.csv\"")
+		out := csv.NewWriter(w)
+		out.Write(auditColumns)
+		write = func(e *AuditEntry) error { return out.Write(auditRecord(e)) }
+		flush = func() error { out.Flush(); return out.Error() }
+	case "ndjson", "json":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", "attachment; filename=\"audit.ndjson\"")
+		encoder := json.NewEncoder(w)
+		write = func(e *AuditEntry) error { return encoder.Encode(e) }
+		flush = func() error { return nil }
+	default:
+		http.Error(w, fmt.Sprintf("format %s is not valid, use csv or ndjson", format), http.StatusBadRequest)
+		return
+	}
+	var writeErr error
+	err := scanAudit(q, false, 0, func(e *AuditEntry) bool {
+		writeErr = write(e)
+		return writeErr == nil
+	})
+	if err == nil {
+		err = writeErr
+	}
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		log.Error("audit export failed", "error", err)
+	}
+}
@@ -0,0 +1,251 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Role permission granted to a client of the APIs
+type Role string
+
+const (
+	// ReadOnly queries the monitors, the sessions, the devices and the events
+	ReadOnly Role = "read-only"
+	// MonitorAdmin starts and stops the monitors and reloads the configuration
+	MonitorAdmin Role = "monitor-admin"
+	// CallControl places and controls calls and changes the device features
+	CallControl Role = "call-control"
+)
+
+// Roles of the APIs
+var Roles = []Role{ReadOnly, MonitorAdmin, CallControl}
+
+// ValidRole of the APIs
+func ValidRole(role string) bool {
+	for _, r := range Roles {
+		if string(r) == role {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// ErrMissingCredentials no API key or bearer token in the request
+	ErrMissingCredentials = errors.New("an API key or a bearer token is required")
+	// ErrInvalidCredentials unknown API key or invalid bearer token
+	ErrInvalidCredentials = errors.New("the API key or the bearer token is not valid")
+	// ErrForbidden the identity lacks the role or the extension of the request
+	ErrForbidden = errors.New("forbidden")
+)
+
+// Identity of the client of a request
+type Identity struct {
+	Name       string
+	Method     string
+	Roles      []Role
+	Extensions []string
+}
+
+// anonymous identity of the requests when the authentication is disabled
+var anonymous = &Identity{Name: "anonymous", Method: "none", Roles: Roles}
+
+// Has the role, every role grants the read-only access
+func (i *Identity) Has(role Role) bool {
+	for _, r := range i.Roles {
+		if r == role || role == ReadOnly {
+			return true
+		}
+	}
+	return false
+}
+
+// Restricted to a set of extensions
+func (i *Identity) Restricted() bool {
+	return len(i.Extensions) > 0
+}
+
+// CanAccess one of the extensions, an identity without restrictions accesses all of them
+func (i *Identity) CanAccess(extensions ...string) bool {
+	if !i.Restricted() {
+		return true
+	}
+	for _, extension := range extensions {
+		if extension == "" {
+			continue
+		}
+		for _, allowed := range i.Extensions {
+			if allowed == extension {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Key API key of a client, only its SHA-256 hash is kept
+type Key struct {
+	Name       string
+	Hash       [sha256.Size]byte
+	Roles      []Role
+	Extensions []string
+}
+
+// NewKey from the key or the hex encoded SHA-256 hash of the key
+func NewKey(name string, key string, keySHA256 string, roles []string, extensions []string) (*Key, error) {
+	k := &Key{Name: name, Extensions: extensions}
+	switch {
+	case key != "" && keySHA256 != "":
+		return nil, fmt.Errorf("key %s: key and keySHA256 are exclusive", name)
+	case key != "":
+		k.Hash = sha256.Sum256([]byte(key))
+	case keySHA256 != "":
+		hash, err := hex.DecodeString(keySHA256)
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("key %s: keySHA256 must be a hex encoded SHA-256 hash", name)
+		}
+		copy(k.Hash[:], hash)
+	default:
+		return nil, fmt.Errorf("key %s: key or keySHA256 is required", name)
+	}
+	for _, role := range roles {
+		if !ValidRole(role) {
+			return nil, fmt.Errorf("key %s: role %q must be %s, %s or %s", name, role, ReadOnly, MonitorAdmin, CallControl)
+		}
+		k.Roles = append(k.Roles, Role(role))
+	}
+	if len(k.Roles) == 0 {
+		return nil, fmt.Errorf("key %s: at least one role is required", name)
+	}
+	return k, nil
+}
+
+// Authenticator of the requests of the APIs, disabled without keys and JWT
+type Authenticator struct {
+	keys []*Key
+	jwt  *JWT
+	lock sync.RWMutex
+}
+
+// New Authenticator of the keys and of the tokens signed for the JWT, both optional
+func New(keys []*Key, jwt *JWT) *Authenticator {
+	a := &Authenticator{}
+	a.Update(keys, jwt)
+	return a
+}
+
+// Update the keys and the JWT, rotating them without a restart
+func (a *Authenticator) Update(keys []*Key, jwt *JWT) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.keys, a.jwt = keys, jwt
+}
+
+// Enabled when keys or a JWT are configured
+func (a *Authenticator) Enabled() bool {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return len(a.keys) > 0 || a.jwt != nil
+}
+
+// credentials of the request: a bearer token, an X-API-Key header or, for the websockets, an access_token parameter
+func credentials(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	}
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	return r.URL.Query().Get("access_token")
+}
+
+// Authenticate the client of the request
+func (a *Authenticator) Authenticate(r *http.Request) (*Identity, error) {
+	a.lock.RLock()
+	keys, jwt := a.keys, a.jwt
+	a.lock.RUnlock()
+	if len(keys) == 0 && jwt == nil {
+		return anonymous, nil
+	}
+
+	credential := credentials(r)
+	if credential == "" {
+		return nil, ErrMissingCredentials
+	}
+	if jwt != nil && strings.Count(credential, ".") == 2 {
+		return jwt.Verify(credential)
+	}
+	hash := sha256.Sum256([]byte(credential))
+	for _, k := range keys {
+		if subtle.ConstantTimeCompare(hash[:], k.Hash[:]) == 1 {
+			return &Identity{Name: k.Name, Method: "api-key", Roles: k.Roles, Extensions: k.Extensions}, nil
+		}
+	}
+	return nil, ErrInvalidCredentials
+}
+
+// Authorize the client of the request for all the roles and, when the request has one, the extension
+func (a *Authenticator) Authorize(r *http.Request, extension string, roles ...Role) (*Identity, error) {
+	identity, err := a.Authenticate(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, role := range roles {
+		if !identity.Has(role) {
+			return identity, fmt.Errorf("%w: %s requires the role %s", ErrForbidden, identity.Name, role)
+		}
+	}
+	if extension != "" && !identity.CanAccess(extension) {
+		return identity, fmt.Errorf("%w: %s is not allowed to access %s", ErrForbidden, identity.Name, extension)
+	}
+	return identity, nil
+}
+
+// Handler authorizing the requests for the roles and the extension of the request, no role makes it public
+func (a *Authenticator) Handler(roles func(*http.Request) []Role, extension func(*http.Request) string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		required := roles(r)
+		if len(required) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		identity, err := a.Authorize(r, extension(r), required...)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), identity)))
+	})
+}
+
+// WriteError of an authentication or an authorization
+func WriteError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrForbidden) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	http.Error(w, err.Error(), http.StatusUnauthorized)
+}
+
+type contextKey struct{}
+
+// NewContext carrying the identity of the client
+func NewContext(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, identity)
+}
+
+// FromContext the identity of the client, anonymous when the request was not authenticated
+func FromContext(ctx context.Context) *Identity {
+	if identity, ok := ctx.Value(contextKey{}).(*Identity); ok {
+		return identity
+	}
+	return anonymous
+}
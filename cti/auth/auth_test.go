@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+func mustKey(t *testing.T, name string, key string, roles []string, extensions []string) *Key {
+	t.Helper()
+	k, err := NewKey(name, key, "", roles, extensions)
+	if err != nil {
+		t.Fatalf("NewKey() error = %v", err)
+	}
+	return k
+}
+
+func TestNewKey(t *testing.T) {
+	hash := sha256.Sum256([]byte("secret"))
+	tests := []struct {
+		name      string
+		key       string
+		keySHA256 string
+		roles     []string
+		wantErr   bool
+	}{
+		{"key", "secret", "", []string{"read-only"}, false},
+		{"hash", "", hex.EncodeToString(hash[:]), []string{"call-control"}, false},
+		{"key and hash", "secret", hex.EncodeToString(hash[:]), []string{"read-only"}, true},
+		{"neither", "", "", []string{"read-only"}, true},
+		{"placeholder hash", "", "REPLACE-WITH-THE-SHA256-OF-THE-KEY", []string{"read-only"}, true},
+		{"short hash", "", "abcd", []string{"read-only"}, true},
+		{"unknown role", "secret", "", []string{"admin"}, true},
+		{"no role", "secret", "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := NewKey("client", tt.key, tt.keySHA256, tt.roles, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && k.Hash != hash {
+				t.Errorf("NewKey() hash = %x, want %x", k.Hash, hash)
+			}
+		})
+	}
+}
+
+func TestIdentityHas(t *testing.T) {
+	tests := []struct {
+		name  string
+		roles []Role
+		role  Role
+		want  bool
+	}{
+		{"same role", []Role{CallControl}, CallControl, true},
+		{"read-only granted by any role", []Role{MonitorAdmin}, ReadOnly, true},
+		{"other role", []Role{ReadOnly}, CallControl, false},
+		{"no roles", nil, ReadOnly, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := &Identity{Name: "client", Roles: tt.roles}
+			if got := i.Has(tt.role); got != tt.want {
+				t.Errorf("Has(%s) = %v, want %v", tt.role, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIdentityCanAccess(t *testing.T) {
+	tests := []struct {
+		name       string
+		allowed    []string
+		extensions []string
+		want       bool
+	}{
+		{"unrestricted", nil, []string{"1000"}, true},
+		{"allowed", []string{"1000", "1001"}, []string{"1001"}, true},
+		{"one of them allowed", []string{"1000"}, []string{"2000", "1000"}, true},
+		{"not allowed", []string{"1000"}, []string{"2000"}, false},
+		{"empty extension", []string{"1000"}, []string{""}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := &Identity{Name: "client", Extensions: tt.allowed}
+			if got := i.CanAccess(tt.extensions...); got != tt.want {
+				t.Errorf("CanAccess(%v) = %v, want %v", tt.extensions, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	keys := []*Key{
+		mustKey(t, "wallboard", "wallboard-key", []string{"read-only"}, nil),
+		mustKey(t, "agent", "agent-key", []string{"call-control"}, []string{"1000"}),
+	}
+	jwt, err := NewJWT("0123456789abcdef0123456789abcdef", "", "")
+	if err != nil {
+		t.Fatalf("NewJWT() error = %v", err)
+	}
+	token, err := jwt.Sign(&Claims{Subject: "crm", ExpiresAt: 1 << 40, Roles: []string{"monitor-admin"}})
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		header    string
+		value     string
+		extension string
+		roles     []Role
+		identity  string
+		wantErr   error
+	}{
+		{"missing credentials", "", "", "", []Role{ReadOnly}, "", ErrMissingCredentials},
+		{"unknown key", "X-API-Key", "other", "", []Role{ReadOnly}, "", ErrInvalidCredentials},
+		{"read-only key", "X-API-Key", "wallboard-key", "", []Role{ReadOnly}, "wallboard", nil},
+		{"key without the role", "X-API-Key", "wallboard-key", "", []Role{CallControl}, "wallboard", ErrForbidden},
+		{"bearer key", "Authorization", "Bearer agent-key", "1000", []Role{CallControl}, "agent", nil},
+		{"restricted extension", "X-API-Key", "agent-key", "2000", []Role{CallControl}, "agent", ErrForbidden},
+		{"jwt", "Authorization", "Bearer " + token, "2000", []Role{MonitorAdmin}, "crm", nil},
+		{"invalid jwt", "Authorization", "Bearer " + token + "x", "", []Role{ReadOnly}, "", ErrInvalidCredentials},
+	}
+	a := New(keys, jwt)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/monitors", nil)
+			if tt.header != "" {
+				r.Header.Set(tt.header, tt.value)
+			}
+			identity, err := a.Authorize(r, tt.extension, tt.roles...)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("Authorize() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.identity != "" && (identity == nil || identity.Name != tt.identity) {
+				t.Errorf("Authorize() identity = %v, want %s", identity, tt.identity)
+			}
+		})
+	}
+}
+
+func TestAuthenticateDisabled(t *testing.T) {
+	a := New(nil, nil)
+	if a.Enabled() {
+		t.Fatal("Enabled() = true without keys and JWT")
+	}
+	identity, err := a.Authenticate(httptest.NewRequest("GET", "/monitors", nil))
+	if err != nil || identity != anonymous {
+		t.Errorf("Authenticate() = %v, %v, want the anonymous identity", identity, err)
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		header string
+		value  string
+		want   string
+	}{
+		{"bearer", "/events/1000", "Authorization", "Bearer  token ", "token"},
+		{"api key", "/events/1000", "X-API-Key", "key", "key"},
+		{"access token", "/events/1000?access_token=param", "", "", "param"},
+		{"basic authorization ignored", "/events/1000", "Authorization", "Basic abc", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.target, nil)
+			if tt.header != "" {
+				r.Header.Set(tt.header, tt.value)
+			}
+			if got := credentials(r); got != tt.want {
+				t.Errorf("credentials() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// clockSkew tolerated on the expiration and the activation of the tokens
+const clockSkew = 30 * time.Second
+
+// minSecretLength of the HS256 secret
+const minSecretLength = 32
+
+// JWT bearer tokens signed with HS256 by an identity provider sharing the secret
+type JWT struct {
+	secret   []byte
+	Issuer   string
+	Audience string
+}
+
+// NewJWT of the secret, the issuer and the audience are verified when set
+func NewJWT(secret string, issuer string, audience string) (*JWT, error) {
+	if len(secret) < minSecretLength {
+		return nil, fmt.Errorf("the JWT secret must have at least %d characters", minSecretLength)
+	}
+	return &JWT{secret: []byte(secret), Issuer: issuer, Audience: audience}, nil
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+}
+
+// audience claim, a string or a list of strings
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// Claims of the tokens, the roles and the extensions are private claims
+type Claims struct {
+	Subject    string   `json:"sub"`
+	Issuer     string   `json:"iss"`
+	Audience   audience `json:"aud"`
+	ExpiresAt  int64    `json:"exp"`
+	NotBefore  int64    `json:"nbf"`
+	Roles      []string `json:"roles"`
+	Extensions []string `json:"extensions"`
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Verify the signature and the claims of the token
+func (j *JWT) Verify(token string) (*Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidCredentials
+	}
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil || h.Alg != "HS256" {
+		return nil, fmt.Errorf("%w: only HS256 tokens are accepted", ErrInvalidCredentials)
+	}
+	mac := hmac.New(sha256.New, j.secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, fmt.Errorf("%w: invalid signature", ErrInvalidCredentials)
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: invalid claims", ErrInvalidCredentials)
+	}
+	if err := j.validate(&claims, time.Now()); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	identity := &Identity{Name: claims.Subject, Method: "jwt", Extensions: claims.Extensions}
+	for _, role := range claims.Roles {
+		if ValidRole(role) {
+			identity.Roles = append(identity.Roles, Role(role))
+		}
+	}
+	return identity, nil
+}
+
+func (j *JWT) validate(claims *Claims, now time.Time) error {
+	if claims.Subject == "" {
+		return errors.New("the subject is required")
+	}
+	if claims.ExpiresAt == 0 {
+		return errors.New("the expiration is required")
+	}
+	if now.Add(-clockSkew).Unix() > claims.ExpiresAt {
+		return errors.New("the token has expired")
+	}
+	if claims.NotBefore != 0 && now.Add(clockSkew).Unix() < claims.NotBefore {
+		return errors.New("the token is not active yet")
+	}
+	if j.Issuer != "" && claims.Issuer != j.Issuer {
+		return fmt.Errorf("the issuer %q is not accepted", claims.Issuer)
+	}
+	if j.Audience != "" {
+		for _, a := range claims.Audience {
+			if a == j.Audience {
+				return nil
+			}
+		}
+		return fmt.Errorf("the audience %s is required", j.Audience)
+	}
+	return nil
+}
+
+// Sign the claims with the secret, for the tools issuing tokens
+func (j *JWT) Sign(claims *Claims) (string, error) {
+	h, _ := json.Marshal(header{Alg: "HS256", Typ: "JWT"})
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	mac := hmac.New(sha256.New, j.secret)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func TestNewJWT(t *testing.T) {
+	if _, err := NewJWT("short", "", ""); err == nil {
+		t.Error("NewJWT() accepted a short secret")
+	}
+	if _, err := NewJWT(testSecret, "", ""); err != nil {
+		t.Errorf("NewJWT() error = %v", err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Now().Unix()
+	jwt, _ := NewJWT(testSecret, "idp", "cti")
+	other, _ := NewJWT(strings.Repeat("x", minSecretLength), "idp", "cti")
+	valid := Claims{Subject: "crm", Issuer: "idp", Audience: audience{"cti"}, ExpiresAt: now + 60, Roles: []string{"call-control", "unknown"}, Extensions: []string{"1000"}}
+
+	sign := func(j *JWT, update func(*Claims)) string {
+		claims := valid
+		if update != nil {
+			update(&claims)
+		}
+		token, err := j.Sign(&claims)
+		if err != nil {
+			t.Fatalf("Sign() error = %v", err)
+		}
+		return token
+	}
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	unsigned := sign(jwt, nil)
+	unsigned = none + unsigned[strings.Index(unsigned, "."):strings.LastIndex(unsigned, ".")] + "."
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"valid", sign(jwt, nil), false},
+		{"audience list", sign(jwt, func(c *Claims) { c.Audience = audience{"other", "cti"} }), false},
+		{"within the clock skew", sign(jwt, func(c *Claims) { c.ExpiresAt = now - 10 }), false},
+		{"expired", sign(jwt, func(c *Claims) { c.ExpiresAt = now - 60 }), true},
+		{"no expiration", sign(jwt, func(c *Claims) { c.ExpiresAt = 0 }), true},
+		{"not active yet", sign(jwt, func(c *Claims) { c.NotBefore = now + 120 }), true},
+		{"no subject", sign(jwt, func(c *Claims) { c.Subject = "" }), true},
+		{"other issuer", sign(jwt, func(c *Claims) { c.Issuer = "other" }), true},
+		{"other audience", sign(jwt, func(c *Claims) { c.Audience = audience{"other"} }), true},
+		{"other secret", sign(other, nil), true},
+		{"alg none", unsigned, true},
+		{"malformed", "a.b", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, err := jwt.Verify(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrInvalidCredentials) {
+					t.Errorf("Verify() error = %v, want ErrInvalidCredentials", err)
+				}
+				return
+			}
+			if identity.Name != "crm" || identity.Method != "jwt" {
+				t.Errorf("Verify() identity = %+v", identity)
+			}
+			if len(identity.Roles) != 1 || identity.Roles[0] != CallControl {
+				t.Errorf("Verify() roles = %v, want [%s]", identity.Roles, CallControl)
+			}
+			if !identity.CanAccess("1000") || identity.CanAccess("2000") {
+				t.Errorf("Verify() extensions = %v, want [1000]", identity.Extensions)
+			}
+		})
+	}
+}
+
+func TestAudienceUnmarshal(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []string
+		wantErr bool
+	}{
+		{"string", `"cti"`, []string{"cti"}, false},
+		{"list", `["cti","crm"]`, []string{"cti", "crm"}, false},
+		{"number", `1`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var a audience
+			err := a.UnmarshalJSON([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UnmarshalJSON() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if strings.Join(a, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("UnmarshalJSON() = %v, want %v", a, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/rresender/csta-integration/cti/auth"
+
+	"github.com/gorilla/mux"
+)
+
+// authenticator of the API, disabled without API keys and JWT secret
+var authenticator *auth.Authenticator
+
+// routeRoles required by the routes of the API, the routes missing from the table require every role
+var routeRoles = map[string][]auth.Role{
+	"/start/{type}/{extension}":           {auth.MonitorAdmin},
+	"/stop/{extension}":                   {auth.MonitorAdmin},
+	"/reload":                             {auth.MonitorAdmin},
+	"/snapshot/{extension}":               {auth.MonitorAdmin},
+	"/devices/{extension}":                {auth.ReadOnly},
+	"/devices/{extension}/{feature}":      {auth.CallControl},
+	"/digits/{extension}":                 {auth.CallControl},
+	"/calls/{extension}/{action}":         {auth.CallControl},
+	"/events/{extension}":                 {auth.ReadOnly},
+	"/monitors":                           {auth.ReadOnly},
+	"/getall":                             {auth.ReadOnly},
+	"/switches":                           {auth.ReadOnly},
+	"/reconciliation":                     {auth.ReadOnly},
+	"/ownership":                          {auth.ReadOnly},
+	"/console":                            {auth.MonitorAdmin, auth.CallControl},
+	"/console/events/{monitorCrossRefID}": {auth.MonitorAdmin, auth.CallControl},
+	"/audit":                              {auth.MonitorAdmin},
+	"/audit/export":                       {auth.MonitorAdmin},
+	"/healthz":                            nil,
+	"/readyz":                             nil,
+	"/metrics":                            nil,
+}
+
+// unrestrictedRoutes list the extensions of every client or their actions,
+// they are denied to the identities restricted to some extensions
+var unrestrictedRoutes = map[string]bool{
+	"/switches":       true,
+	"/reload":         true,
+	"/ownership":      true,
+	"/reconciliation": true,
+	"/audit":          true,
+	"/audit/export":   true,
+}
+
+func routeTemplate(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return ""
+	}
+	template, _ := route.GetPathTemplate()
+	return template
+}
+
+func requiredRoles(r *http.Request) []auth.Role {
+	template := routeTemplate(r)
+	if template == "" {
+		return auth.Roles
+	}
+	roles, ok := routeRoles[template]
+	if !ok {
+		return auth.Roles
+	}
+	return roles
+}
+
+func requestExtension(r *http.Request) string {
+	return mux.Vars(r)["extension"]
+}
+
+// authorize the requests of the API by the roles of their routes and their extension
+func authorize(next http.Handler) http.Handler {
+	return authenticator.Handler(requiredRoles, requestExtension, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if identity := auth.FromContext(r.Context()); identity.Restricted() && unrestrictedRoutes[routeTemplate(r)] {
+			auth.WriteError(w, fmt.Errorf("%w: %s is restricted to some extensions", auth.ErrForbidden, identity.Name))
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// allowedExtensions of the identity of the request
+func allowedExtensions(r *http.Request, extensions []string) []string {
+	identity := auth.FromContext(r.Context())
+	if !identity.Restricted() {
+		return extensions
+	}
+	allowed := []string{}
+	for _, extension := range extensions {
+		if identity.CanAccess(extension) {
+			allowed = append(allowed, extension)
+		}
+	}
+	return allowed
+}
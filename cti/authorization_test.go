@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/rresender/csta-integration/cti/auth"
+)
+
+func testKey(t *testing.T, name string, key string, roles []string, extensions []string) *auth.Key {
+	t.Helper()
+	k, err := auth.NewKey(name, key, "", roles, extensions)
+	if err != nil {
+		t.Fatalf("NewKey() error = %v", err)
+	}
+	return k
+}
+
+func TestAuthorize(t *testing.T) {
+	authenticator = auth.New([]*auth.Key{
+		testKey(t, "ops", "ops-key", []string{"monitor-admin"}, nil),
+		testKey(t, "agent", "agent-key", []string{"call-control"}, []string{"1000"}),
+		testKey(t, "site-ops", "site-ops-key", []string{"monitor-admin"}, []string{"1000", "1001"}),
+	}, nil)
+	defer func() { authenticator = nil }()
+
+	router := mux.NewRouter()
+	router.Use(authorize)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for template := range routeRoles {
+		router.Handle(template, ok)
+	}
+	router.Handle("/unlisted", ok)
+
+	tests := []struct {
+		name   string
+		target string
+		key    string
+		want   int
+	}{
+		{"public route", "/healthz", "", http.StatusOK},
+		{"missing credentials", "/monitors", "", http.StatusUnauthorized},
+		{"unknown key", "/monitors", "other", http.StatusUnauthorized},
+		{"read-only route", "/monitors", "agent-key", http.StatusOK},
+		{"role of the route", "/start/VDN/5000", "ops-key", http.StatusOK},
+		{"missing role", "/start/VDN/5000", "agent-key", http.StatusForbidden},
+		{"allowed extension", "/calls/1000/answer", "agent-key", http.StatusOK},
+		{"restricted extension", "/calls/2000/answer", "agent-key", http.StatusForbidden},
+		{"every role for unlisted routes", "/unlisted", "ops-key", http.StatusForbidden},
+		{"switches unrestricted", "/switches", "ops-key", http.StatusOK},
+		{"switches restricted", "/switches", "agent-key", http.StatusForbidden},
+		{"ownership restricted", "/ownership", "agent-key", http.StatusForbidden},
+		{"reconciliation restricted", "/reconciliation", "agent-key", http.StatusForbidden},
+		{"audit restricted", "/audit", "agent-key", http.StatusForbidden},
+		{"audit export restricted", "/audit/export", "agent-key", http.StatusForbidden},
+		{"snapshot publishes for monitor-admin", "/snapshot/1000", "site-ops-key", http.StatusOK},
+		{"snapshot denied to call-control", "/snapshot/1000", "agent-key", http.StatusForbidden},
+		{"reload unrestricted", "/reload", "ops-key", http.StatusOK},
+		{"reload denied to a restricted monitor-admin", "/reload", "site-ops-key", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.target, nil)
+			if tt.key != "" {
+				r.Header.Set("X-API-Key", tt.key)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("GET %s = %d, want %d: %s", tt.target, w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAllowedExtensions(t *testing.T) {
+	extensions := []string{"1000", "1001", "2000"}
+	tests := []struct {
+		name     string
+		identity *auth.Identity
+		want     []string
+	}{
+		{"unrestricted", &auth.Identity{Name: "ops"}, extensions},
+		{"restricted", &auth.Identity{Name: "agent", Extensions: []string{"1001", "3000"}}, []string{"1001"}},
+		{"none allowed", &auth.Identity{Name: "agent", Extensions: []string{"3000"}}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/monitors", nil)
+			r = r.WithContext(auth.NewContext(r.Context(), tt.identity))
+			got := allowedExtensions(r, extensions)
+			if len(got) != len(tt.want) {
+				t.Fatalf("allowedExtensions() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("allowedExtensions() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/rresender/csta-integration/cti/provider"
+	"github.com/rresender/csta-integration/cti/uui"
+)
+
+// CallCommand call control request of the API on the device of an extension
+type CallCommand struct {
+	Action      string
+	CallID      string
+	Destination string
+	UUI         string
+	UUIFormat   string
+}
+
+// CallResult call created or transferred by a call control request
+type CallResult struct {
+	CallID   string `json:"callID,omitempty"`
+	DeviceID string `json:"deviceID,omitempty"`
+}
+
+var (
+	// callIDPattern of the call identifiers assigned by the provider
+	callIDPattern = regexp.MustCompile(`^[0-9]{1,16}$`)
+	// destinationPattern of the numbers dialed, transferred or forwarded to
+	destinationPattern = regexp.MustCompile(`^\+?[0-9*#]{1,32}$`)
+)
+
+// validateCallID of a request on an existing call
+func validateCallID(callID string) error {
+	if callID == "" {
+		return invalidRequest(errors.New("callID is required"))
+	}
+	if !callIDPattern.MatchString(callID) {
+		return invalidRequest(fmt.Errorf("callID %q is not valid", callID))
+	}
+	return nil
+}
+
+// validateDestination of a call or of a forwarding
+func validateDestination(destination string) error {
+	if destination == "" {
+		return invalidRequest(errors.New("destination is required"))
+	}
+	if !destinationPattern.MatchString(destination) {
+		return invalidRequest(fmt.Errorf("destination %q must contain only digits, * and #, optionally prefixed by +", destination))
+	}
+	return nil
+}
+
+// callActions call control request on an existing call of a device
+var callActions = map[string]func(callID string, deviceID string) (string, interface{}){
+	"answer": func(callID string, deviceID string) (string, interface{}) {
+		return provider.AnswerCallMessage(callID, deviceID), &provider.AnswerCallResponse{}
+	},
+	"clear": func(callID string, deviceID string) (string, interface{}) {
+		return provider.ClearConnectionMessage(callID, deviceID), &provider.ClearConnectionResponse{}
+	},
+	"hold": func(callID string, deviceID string) (string, interface{}) {
+		return provider.HoldCallMessage(callID, deviceID), &provider.HoldCallResponse{}
+	},
+	"retrieve": func(callID string, deviceID string) (string, interface{}) {
+		return provider.RetrieveCallMessage(callID, deviceID), &provider.RetrieveCallResponse{}
+	},
+}
+
+// encodeUUI of a call control request as the hex encoded user data of the provider,
+// in the plain, hex or shared format
+func encodeUUI(text string, format string) (string, error) {
+	f, err := uui.ParseFormat(format)
+	if err != nil || text == "" {
+		return "", invalidRequest(err)
+	}
+	u, err := uui.New(f, text)
+	if err != nil {
+		return "", invalidRequest(err)
+	}
+	encoded, err := u.Encode()
+	return encoded, invalidRequest(err)
+}
+
+// validate the command of the API before its message is built
+func (c *CallCommand) validate() error {
+	if _, ok := callActions[c.Action]; !ok && c.Action != "make" && c.Action != "transfer" {
+		return invalidRequest(fmt.Errorf("action %q is not valid", c.Action))
+	}
+	if c.Action != "make" {
+		if err := validateCallID(c.CallID); err != nil {
+			return err
+		}
+	}
+	if c.Action == "make" || c.Action == "transfer" {
+		return validateDestination(c.Destination)
+	}
+	return nil
+}
+
+// callControl runs the call control command on the device of the extension
+func (s *Switch) callControl(extension string, command *CallCommand) (*CallResult, error) {
+	if err := command.validate(); err != nil {
+		return nil, err
+	}
+	action := callActions[command.Action]
+	userData, err := encodeUUI(command.UUI, command.UUIFormat)
+	if err != nil {
+		return nil, err
+	}
+	deviceID, err := s.getDeviceID(extension)
+	if err != nil {
+		return nil, err
+	}
+
+	switch command.Action {
+	case "make":
+		var response provider.MakeCallResponse
+		if err := s.request(extension, provider.MakeCallMessage(deviceID, command.Destination, userData), &response); err != nil {
+			return nil, err
+		}
+		return &CallResult{CallID: response.CallingDevice.CallID, DeviceID: response.CallingDevice.DeviceID}, nil
+	case "transfer":
+		var response provider.SingleStepTransferCallResponse
+		if err := s.request(extension, provider.SingleStepTransferCallMessage(command.CallID, deviceID, command.Destination, userData), &response); err != nil {
+			return nil, err
+		}
+		return &CallResult{CallID: response.TransferredCall.CallID, DeviceID: response.TransferredCall.DeviceID}, nil
+	}
+	message, response := action(command.CallID, deviceID)
+	if err := s.request(extension, message, response); err != nil {
+		return nil, err
+	}
+	return &CallResult{CallID: command.CallID, DeviceID: deviceID}, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rresender/csta-integration/cti/provider"
+)
+
+func TestCallCommandValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		command CallCommand
+		wantErr string
+	}{
+		{"make", CallCommand{Action: "make", Destination: "+5511999"}, ""},
+		{"answer", CallCommand{Action: "answer", CallID: "42"}, ""},
+		{"transfer", CallCommand{Action: "transfer", CallID: "42", Destination: "2000"}, ""},
+		{"unknown action", CallCommand{Action: "park", CallID: "42"}, `action "park" is not valid`},
+		{"missing call", CallCommand{Action: "hold"}, "callID is required"},
+		{"injected call", CallCommand{Action: "clear", CallID: "42</callID><deviceID>1"}, "is not valid"},
+		{"missing destination", CallCommand{Action: "make"}, "destination is required"},
+		{"injected destination", CallCommand{Action: "transfer", CallID: "42", Destination: "2000</transferredTo>"}, "must contain only digits"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.command.validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEncodeUUI(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{"no uui", "", "shared", "", false},
+		{"plain by default", "order=1", "", "6F726465723D31", false},
+		{"hex", "C8010A", "hex", "C8010A", false},
+		{"shared", "order=1", "shared", "FA076F726465723D31", false},
+		{"invalid hex", "order=1", "hex", "", true},
+		{"unknown format", "order=1", "asai", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := encodeUUI(tt.text, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("encodeUUI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("encodeUUI() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodedUUIRequest(t *testing.T) {
+	userData, err := encodeUUI("order=1", "shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, message := range map[string]string{
+		"make":     provider.MakeCallMessage("1000:pbx::0", "2000", userData),
+		"transfer": provider.SingleStepTransferCallMessage("42", "1000:pbx::0", "2000", userData),
+	} {
+		if want := "<userData><string>FA076F726465723D31</string></userData>"; !strings.Contains(message, want) {
+			t.Errorf("%s request = %s, want %s", name, message, want)
+		}
+	}
+}
@@ -0,0 +1,543 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rresender/csta-integration/cti/auth"
+	"github.com/rresender/csta-integration/cti/provider"
+	"gopkg.in/yaml.v3"
+)
+
+// Cluster modes of the service
+const (
+	// SingleMode every instance handles all of its switches
+	SingleMode = "single"
+	// HAMode one instance, the leader, handles each switch while the others stand by
+	HAMode = "ha"
+	// ShardedMode the instances share the extensions of each switch
+	ShardedMode = "sharded"
+)
+
+// Extension types
+const (
+	VDN   = "VDN"
+	Skill = "SKILL"
+)
+
+// ExtensionConfig extension monitored on start up
+type ExtensionConfig struct {
+	ID     string   `yaml:"id" json:"id"`
+	Type   string   `yaml:"type" json:"type"`
+	Events []string `yaml:"events" json:"events"`
+}
+
+// SwitchConfig CTI provider and PBX handled by the service
+type SwitchConfig struct {
+	Name                string            `yaml:"name" json:"name"`
+	ProviderHost        string            `yaml:"provider" json:"provider"`
+	PBX                 string            `yaml:"pbx" json:"pbx"`
+	User                string            `yaml:"user" json:"user"`
+	Password            string            `yaml:"password" json:"password"`
+	SessionDuration     int               `yaml:"sessionDuration" json:"sessionDuration"`
+	SessionCleanupDelay int               `yaml:"sessionCleanupDelay" json:"sessionCleanupDelay"`
+	Extensions          []ExtensionConfig `yaml:"extensions" json:"extensions"`
+	RoutingDevices      []string          `yaml:"routingDevices" json:"routingDevices"`
+	TLS                 TLSConfig         `yaml:"tls" json:"tls"`
+}
+
+// HTTPConfig of the API, URL is the address of the API used by the consumers with the API key
+// or bearer token Token, the raw CSTA console is enabled only with a console token
+type HTTPConfig struct {
+	Address      string `yaml:"address"`
+	URL          string `yaml:"url"`
+	Token        string `yaml:"token"`
+	ConsoleToken string `yaml:"consoleToken"`
+}
+
+// RedisConfig RedisConfig
+type RedisConfig struct {
+	Host string `yaml:"host"`
+}
+
+// RabbitMQConfig RabbitMQConfig
+type RabbitMQConfig struct {
+	Host     string `yaml:"host"`
+	Port     string `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+}
+
+// URL of the RabbitMQ broker
+func (c RabbitMQConfig) URL() string {
+	return fmt.Sprintf("amqp://%s:%s@%s:%s/", c.User, c.Password, c.Host, c.Port)
+}
+
+// RoutingConfig router of the routing devices, the webhook URL takes precedence over the rules file
+type RoutingConfig struct {
+	URL       string `yaml:"url"`
+	RulesFile string `yaml:"rulesFile"`
+}
+
+// APIKeyConfig API key of a client of the APIs, restricted to the extensions when they are set
+type APIKeyConfig struct {
+	Name       string   `yaml:"name"`
+	Key        string   `yaml:"key"`
+	KeySHA256  string   `yaml:"keySHA256"`
+	Roles      []string `yaml:"roles"`
+	Extensions []string `yaml:"extensions"`
+}
+
+// AuthConfig of the APIs, the authentication is disabled without keys and JWT secret
+type AuthConfig struct {
+	Keys        []APIKeyConfig `yaml:"keys"`
+	JWTSecret   string         `yaml:"jwtSecret"`
+	JWTIssuer   string         `yaml:"jwtIssuer"`
+	JWTAudience string         `yaml:"jwtAudience"`
+}
+
+// Authenticator of the keys and of the JWT secret
+func (c AuthConfig) Authenticator() (*auth.Authenticator, error) {
+	keys, jwt, err := c.credentials()
+	if err != nil {
+		return nil, err
+	}
+	return auth.New(keys, jwt), nil
+}
+
+// Update the keys and the JWT secret of the authenticator
+func (c AuthConfig) Update(a *auth.Authenticator) error {
+	keys, jwt, err := c.credentials()
+	if err != nil {
+		return err
+	}
+	a.Update(keys, jwt)
+	return nil
+}
+
+func (c AuthConfig) credentials() ([]*auth.Key, *auth.JWT, error) {
+	var keys []*auth.Key
+	for _, k := range c.Keys {
+		key, err := auth.NewKey(k.Name, k.Key, k.KeySHA256, k.Roles, k.Extensions)
+		if err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, key)
+	}
+	if c.JWTSecret == "" {
+		return keys, nil, nil
+	}
+	jwt, err := auth.NewJWT(c.JWTSecret, c.JWTIssuer, c.JWTAudience)
+	return keys, jwt, err
+}
+
+// Config of the service and of the sample consumer
+type Config struct {
+	Mode         string         `yaml:"mode"`
+	RedactDigits bool           `yaml:"redactDigits"`
+	HTTP         HTTPConfig     `yaml:"http"`
+	Redis        RedisConfig    `yaml:"redis"`
+	RabbitMQ     RabbitMQConfig `yaml:"rabbitmq"`
+	Routing      RoutingConfig  `yaml:"routing"`
+	Auth         AuthConfig     `yaml:"auth"`
+	Switches     []SwitchConfig `yaml:"switches"`
+}
+
+// ValidationError problems found in a configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(e.Problems, "; ")
+}
+
+func (e *ValidationError) add(format string, args ...interface{}) {
+	e.Problems = append(e.Problems, fmt.Sprintf(format, args...))
+}
+
+func defaults() *Config {
+	return &Config{
+		Mode:     SingleMode,
+		HTTP:     HTTPConfig{Address: ":7700"},
+		Redis:    RedisConfig{Host: "redis:6379"},
+		RabbitMQ: RabbitMQConfig{Host: "rabbitmq", Port: "5672", User: "guest", Password: "guest"},
+	}
+}
+
+// defaultSwitch configured only by the environment
+func defaultSwitch() SwitchConfig {
+	return SwitchConfig{
+		Name:         "default",
+		ProviderHost: "localhost:4721",
+		PBX:          "localhost",
+		User:         "ctiuser",
+		Password:     "ctipassword",
+	}
+}
+
+// Load the configuration from CONFIG_FILE (YAML) or SWITCHES_FILE (JSON switches),
+// overridden by the environment, and validate it
+func Load() (*Config, error) {
+	c := defaults()
+	if file := os.Getenv("CONFIG_FILE"); file != "" {
+		if err := c.loadFile(file); err != nil {
+			return nil, err
+		}
+	}
+	if file := os.Getenv("SWITCHES_FILE"); file != "" {
+		if err := c.loadSwitches(file); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.applyEnv(); err != nil {
+		return nil, err
+	}
+	c.normalize()
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Files loaded by Load, watched for the changes of the configuration
+func Files() []string {
+	var files []string
+	for _, key := range []string{"CONFIG_FILE", "SWITCHES_FILE"} {
+		if file := os.Getenv(key); file != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+func (c *Config) loadFile(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("invalid configuration file %s: %v", file, err)
+	}
+	return nil
+}
+
+func (c *Config) loadSwitches(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var switches []SwitchConfig
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&switches); err != nil {
+		return fmt.Errorf("invalid switches file %s: %v", file, err)
+	}
+	c.Switches = switches
+	return nil
+}
+
+func setString(target *string, key string) {
+	if value := os.Getenv(key); value != "" {
+		*target = value
+	}
+}
+
+func setInt(target *int, key string) error {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("%s must be a number of seconds: %q", key, value)
+	}
+	*target = v
+	return nil
+}
+
+// switchOverrides environment variables of a single switch
+var switchOverrides = []string{"PROVIDER_HOST", "PBX_HOST", "CTI_USER", "CTI_PASSWORD",
+	"SESSION_DURATION", "SESSION_CLEANUP_DELAY", "MONITORED_EXTENSIONS", "ROUTING_DEVICES",
+	"PROVIDER_TLS", "PROVIDER_TLS_CA_FILE", "PROVIDER_TLS_CERT_FILE", "PROVIDER_TLS_KEY_FILE",
+	"PROVIDER_TLS_SERVER_NAME", "PROVIDER_TLS_MIN_VERSION"}
+
+func (c *Config) applyEnv() error {
+	setString(&c.Mode, "CLUSTER_MODE")
+	setString(&c.HTTP.Address, "HTTP_ADDRESS")
+	setString(&c.HTTP.URL, "CTI_URL")
+	setString(&c.HTTP.Token, "CTI_TOKEN")
+	setString(&c.HTTP.ConsoleToken, "CONSOLE_TOKEN")
+	setString(&c.Redis.Host, "REDIS_HOST")
+	setString(&c.RabbitMQ.Host, "RABBITMQ_PORT_5672_TCP_ADDR")
+	setString(&c.RabbitMQ.Port, "RABBITMQ_PORT_5672_TCP_PORT")
+	setString(&c.RabbitMQ.User, "RABBITMQ_USER")
+	setString(&c.RabbitMQ.Password, "RABBITMQ_PASS")
+	setString(&c.Routing.URL, "ROUTING_URL")
+	setString(&c.Routing.RulesFile, "ROUTING_RULES_FILE")
+	setString(&c.Auth.JWTSecret, "JWT_SECRET")
+	setString(&c.Auth.JWTIssuer, "JWT_ISSUER")
+	setString(&c.Auth.JWTAudience, "JWT_AUDIENCE")
+	if value := os.Getenv("API_KEYS"); value != "" {
+		keys, err := ParseAPIKeys(value)
+		if err != nil {
+			return err
+		}
+		c.Auth.Keys = keys
+	}
+	if value := os.Getenv("REDACT_DIGITS"); value != "" {
+		redact, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("REDACT_DIGITS must be true or false: %q", value)
+		}
+		c.RedactDigits = redact
+	}
+
+	if len(c.Switches) == 0 {
+		c.Switches = []SwitchConfig{defaultSwitch()}
+	}
+	s, err := c.overriddenSwitch()
+	if err != nil || s == nil {
+		return err
+	}
+	setString(&s.Name, "SWITCH_NAME")
+	setString(&s.ProviderHost, "PROVIDER_HOST")
+	setString(&s.PBX, "PBX_HOST")
+	setString(&s.User, "CTI_USER")
+	setString(&s.Password, "CTI_PASSWORD")
+	if err := setInt(&s.SessionDuration, "SESSION_DURATION"); err != nil {
+		return err
+	}
+	if err := setInt(&s.SessionCleanupDelay, "SESSION_CLEANUP_DELAY"); err != nil {
+		return err
+	}
+	if value := os.Getenv("MONITORED_EXTENSIONS"); value != "" {
+		if s.Extensions, err = ParseExtensions(value); err != nil {
+			return err
+		}
+	}
+	if value := os.Getenv("PROVIDER_TLS"); value != "" {
+		if s.TLS.Enabled, err = strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("PROVIDER_TLS must be true or false: %q", value)
+		}
+	}
+	setString(&s.TLS.CAFile, "PROVIDER_TLS_CA_FILE")
+	setString(&s.TLS.CertFile, "PROVIDER_TLS_CERT_FILE")
+	setString(&s.TLS.KeyFile, "PROVIDER_TLS_KEY_FILE")
+	setString(&s.TLS.ServerName, "PROVIDER_TLS_SERVER_NAME")
+	setString(&s.TLS.MinVersion, "PROVIDER_TLS_MIN_VERSION")
+	if value := os.Getenv("ROUTING_DEVICES"); value != "" {
+		s.RoutingDevices = nil
+		for _, device := range strings.Split(value, ",") {
+			if device = strings.TrimSpace(device); device != "" {
+				s.RoutingDevices = append(s.RoutingDevices, device)
+			}
+		}
+	}
+	return nil
+}
+
+// overriddenSwitch by the environment: the only switch, or the one named by SWITCH_NAME
+func (c *Config) overriddenSwitch() (*SwitchConfig, error) {
+	if len(c.Switches) == 1 {
+		return &c.Switches[0], nil
+	}
+	name := os.Getenv("SWITCH_NAME")
+	for i := range c.Switches {
+		if c.Switches[i].Name == name {
+			return &c.Switches[i], nil
+		}
+	}
+	for _, key := range switchOverrides {
+		if os.Getenv(key) != "" {
+			return nil, fmt.Errorf("%s requires SWITCH_NAME to name one of the %d configured switches", key, len(c.Switches))
+		}
+	}
+	return nil, nil
+}
+
+// ParseExtensions of the form "<extension>:<type>,<extension>:<type>"
+func ParseExtensions(value string) ([]ExtensionConfig, error) {
+	var extensions []ExtensionConfig
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("MONITORED_EXTENSIONS: entry %q must be <extension>:<type>", entry)
+		}
+		extensions = append(extensions, ExtensionConfig{ID: strings.TrimSpace(parts[0]), Type: strings.TrimSpace(parts[1])})
+	}
+	return extensions, nil
+}
+
+// ParseAPIKeys of the form "<name>:<key>:<role>|<role>[:<extension>|<extension>],..."
+func ParseAPIKeys(value string) ([]APIKeyConfig, error) {
+	var keys []APIKeyConfig
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		if len(parts) < 3 || len(parts) > 4 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("API_KEYS: entries must be <name>:<key>:<role>|<role>[:<extension>|<extension>]")
+		}
+		key := APIKeyConfig{Name: parts[0], Key: parts[1], Roles: strings.Split(parts[2], "|")}
+		if len(parts) == 4 && parts[3] != "" {
+			key.Extensions = strings.Split(parts[3], "|")
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (c *Config) normalize() {
+	c.Mode = strings.ToLower(c.Mode)
+	c.HTTP.URL = strings.TrimSuffix(c.HTTP.URL, "/")
+	for i := range c.Switches {
+		for j := range c.Switches[i].Extensions {
+			c.Switches[i].Extensions[j].Type = strings.ToUpper(c.Switches[i].Extensions[j].Type)
+		}
+	}
+}
+
+// Validate the configuration reporting every problem found
+func (c *Config) Validate() error {
+	e := &ValidationError{}
+	switch c.Mode {
+	case SingleMode, HAMode, ShardedMode:
+	default:
+		e.add("mode %q must be %s, %s or %s", c.Mode, SingleMode, HAMode, ShardedMode)
+	}
+	if c.HTTP.Address == "" {
+		e.add("http.address is required")
+	}
+	if _, _, err := net.SplitHostPort(c.Redis.Host); err != nil {
+		e.add("redis.host %q must be <host>:<port>", c.Redis.Host)
+	}
+	if c.RabbitMQ.Host == "" {
+		e.add("rabbitmq.host is required")
+	}
+	if _, err := strconv.Atoi(c.RabbitMQ.Port); err != nil {
+		e.add("rabbitmq.port %q must be a number", c.RabbitMQ.Port)
+	}
+	if len(c.Switches) == 0 {
+		e.add("at least one switch is required")
+	}
+	names := make(map[string]bool)
+	for i, s := range c.Switches {
+		prefix := fmt.Sprintf("switches[%d]", i)
+		if s.Name == "" {
+			e.add("%s: name is required", prefix)
+		} else {
+			prefix = fmt.Sprintf("switch %s", s.Name)
+			if names[s.Name] {
+				e.add("%s is duplicated", prefix)
+			}
+			names[s.Name] = true
+		}
+		validateSwitch(e, prefix, s)
+	}
+	validateAuth(e, c.Auth)
+	if len(e.Problems) > 0 {
+		return e
+	}
+	return nil
+}
+
+func validateAuth(e *ValidationError, c AuthConfig) {
+	names := make(map[string]bool)
+	for i, k := range c.Keys {
+		if k.Name == "" {
+			e.add("auth.keys[%d]: name is required", i)
+		} else if names[k.Name] {
+			e.add("auth: key %s is duplicated", k.Name)
+		}
+		names[k.Name] = true
+		if _, err := auth.NewKey(k.Name, k.Key, k.KeySHA256, k.Roles, k.Extensions); err != nil {
+			e.add("auth: %v", err)
+		}
+	}
+	if c.JWTSecret != "" {
+		if _, err := auth.NewJWT(c.JWTSecret, c.JWTIssuer, c.JWTAudience); err != nil {
+			e.add("auth: %v", err)
+		}
+	}
+}
+
+func validateSwitch(e *ValidationError, prefix string, s SwitchConfig) {
+	if _, _, err := net.SplitHostPort(s.ProviderHost); err != nil {
+		e.add("%s: provider %q must be <host>:<port>", prefix, s.ProviderHost)
+	}
+	if s.PBX == "" {
+		e.add("%s: pbx is required", prefix)
+	}
+	if s.User == "" || s.Password == "" {
+		e.add("%s: user and password are required", prefix)
+	}
+	if s.SessionDuration < 0 || s.SessionCleanupDelay < 0 {
+		e.add("%s: sessionDuration and sessionCleanupDelay must not be negative", prefix)
+	}
+	validateTLS(e, prefix, s.TLS)
+	known := make(map[string]bool)
+	for _, event := range provider.CallControlEvents {
+		known[event] = true
+	}
+	extensions := make(map[string]bool)
+	for _, ext := range s.Extensions {
+		if ext.ID == "" || strings.ContainsAny(ext.ID, ":, ") {
+			e.add("%s: extension %q is not valid", prefix, ext.ID)
+			continue
+		}
+		if extensions[ext.ID] {
+			e.add("%s: extension %s is duplicated", prefix, ext.ID)
+		}
+		extensions[ext.ID] = true
+		switch ext.Type {
+		case VDN:
+		case Skill:
+			if len(ext.Events) > 0 {
+				e.add("%s: extension %s: events are only supported by VDN monitors", prefix, ext.ID)
+			}
+		default:
+			e.add("%s: extension %s: type %q must be %s or %s", prefix, ext.ID, ext.Type, VDN, Skill)
+		}
+		for _, event := range ext.Events {
+			if !known[event] {
+				e.add("%s: extension %s: event %q is not valid", prefix, ext.ID, event)
+			}
+		}
+	}
+	for _, device := range s.RoutingDevices {
+		if extensions[device] {
+			e.add("%s: routing device %s is also a monitored extension", prefix, device)
+		}
+	}
+}
+
+// Topic extension of a switch, as consumed by the sample consumer
+type Topic struct {
+	Switch string
+	ExtensionConfig
+}
+
+// Topics extensions of every switch
+func (c *Config) Topics() []Topic {
+	var topics []Topic
+	for _, s := range c.Switches {
+		for _, e := range s.Extensions {
+			topics = append(topics, Topic{Switch: s.Name, ExtensionConfig: e})
+		}
+	}
+	return topics
+}
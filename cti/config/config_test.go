@@ -0,0 +1,301 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func validConfig() *Config {
+	c := defaults()
+	s := defaultSwitch()
+	s.Extensions = []ExtensionConfig{{ID: "5000", Type: VDN}, {ID: "100", Type: Skill}}
+	c.Switches = []SwitchConfig{s}
+	return c
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		update   func(*Config)
+		problems []string
+	}{
+		{"valid", func(c *Config) {}, nil},
+		{"mode", func(c *Config) { c.Mode = "cluster" }, []string{`mode "cluster" must be single, ha or sharded`}},
+		{"redis host", func(c *Config) { c.Redis.Host = "redis" }, []string{`redis.host "redis" must be <host>:<port>`}},
+		{"rabbitmq port", func(c *Config) { c.RabbitMQ.Port = "amqp" }, []string{`rabbitmq.port "amqp" must be a number`}},
+		{"no switch", func(c *Config) { c.Switches = nil }, []string{"at least one switch is required"}},
+		{"switch name", func(c *Config) { c.Switches[0].Name = "" }, []string{"switches[0]: name is required"}},
+		{"duplicated switch", func(c *Config) { c.Switches = append(c.Switches, c.Switches[0]) }, []string{"switch default is duplicated"}},
+		{"provider", func(c *Config) { c.Switches[0].ProviderHost = "aes" }, []string{`switch default: provider "aes" must be <host>:<port>`}},
+		{"credentials", func(c *Config) { c.Switches[0].Password = "" }, []string{"switch default: user and password are required"}},
+		{"negative duration", func(c *Config) { c.Switches[0].SessionDuration = -1 }, []string{"switch default: sessionDuration and sessionCleanupDelay must not be negative"}},
+		{"extension type", func(c *Config) { c.Switches[0].Extensions[0].Type = "AGENT" }, []string{`switch default: extension 5000: type "AGENT" must be VDN or SKILL`}},
+		{"duplicated extension", func(c *Config) { c.Switches[0].Extensions[1].ID = "5000" }, []string{"switch default: extension 5000 is duplicated"}},
+		{"invalid extension", func(c *Config) { c.Switches[0].Extensions[0].ID = "50:00" }, []string{`switch default: extension "50:00" is not valid`}},
+		{"unknown event", func(c *Config) { c.Switches[0].Extensions[0].Events = []string{"ringing"} }, []string{`switch default: extension 5000: event "ringing" is not valid`}},
+		{"skill events", func(c *Config) { c.Switches[0].Extensions[1].Events = []string{"delivered"} }, []string{"switch default: extension 100: events are only supported by VDN monitors"}},
+		{"monitored routing device", func(c *Config) { c.Switches[0].RoutingDevices = []string{"5000"} }, []string{"switch default: routing device 5000 is also a monitored extension"}},
+		{"tls min version", func(c *Config) { c.Switches[0].TLS = TLSConfig{Enabled: true, MinVersion: "1.4"} }, []string{`switch default: tls.minVersion "1.4" must be 1.0, 1.1, 1.2 or 1.3`}},
+		{"tls key pair", func(c *Config) { c.Switches[0].TLS = TLSConfig{Enabled: true, CertFile: "cert.pem"} }, []string{"switch default: tls.certFile and tls.keyFile are required together"}},
+		{"tls disabled", func(c *Config) { c.Switches[0].TLS = TLSConfig{MinVersion: "1.4"} }, nil},
+		{"key hash", func(c *Config) {
+			c.Auth.Keys = []APIKeyConfig{{Name: "ops", KeySHA256: "REPLACE-WITH-THE-SHA256-OF-THE-OPERATIONS-KEY", Roles: []string{"read-only"}}}
+		}, []string{"auth: key ops: keySHA256 must be a hex encoded SHA-256 hash"}},
+		{"duplicated key", func(c *Config) {
+			c.Auth.Keys = []APIKeyConfig{{Name: "ops", Key: "a", Roles: []string{"read-only"}}, {Name: "ops", Key: "b", Roles: []string{"read-only"}}}
+		}, []string{"auth: key ops is duplicated"}},
+		{"jwt secret", func(c *Config) { c.Auth.JWTSecret = "short" }, []string{"auth: the JWT secret must have at least 32 characters"}},
+		{"every problem", func(c *Config) {
+			c.HTTP.Address = ""
+			c.RabbitMQ.Host = ""
+			c.Switches[0].PBX = ""
+		}, []string{"http.address is required", "rabbitmq.host is required", "switch default: pbx is required"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validConfig()
+			tt.update(c)
+			err := c.Validate()
+			if tt.problems == nil {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("Validate() error = %v, want a ValidationError", err)
+			}
+			if !reflect.DeepEqual(validationErr.Problems, tt.problems) {
+				t.Errorf("Validate() problems = %q, want %q", validationErr.Problems, tt.problems)
+			}
+		})
+	}
+}
+
+// clearEnv of the variables read by Load so that the tests do not depend on the environment
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, key := range append([]string{"CONFIG_FILE", "SWITCHES_FILE", "CLUSTER_MODE", "HTTP_ADDRESS", "CTI_URL",
+		"CTI_TOKEN", "CONSOLE_TOKEN", "REDIS_HOST", "RABBITMQ_PORT_5672_TCP_ADDR", "RABBITMQ_PORT_5672_TCP_PORT",
+		"RABBITMQ_USER", "RABBITMQ_PASS", "ROUTING_URL", "ROUTING_RULES_FILE", "JWT_SECRET", "JWT_ISSUER",
+		"JWT_AUDIENCE", "API_KEYS", "REDACT_DIGITS", "SWITCH_NAME"}, switchOverrides...) {
+		t.Setenv(key, "")
+	}
+}
+
+func writeFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+const twoSwitches = `
+mode: HA
+http:
+  url: http://cti:7700/
+switches:
+  - name: east
+    provider: aes-east:4721
+    pbx: cm-east
+    user: cti
+    password: secret
+    extensions:
+      - id: "5000"
+        type: vdn
+  - name: west
+    provider: aes-west:4721
+    pbx: cm-west
+    user: cti
+    password: secret
+`
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		check   func(*testing.T, *Config)
+		wantErr string
+	}{
+		{"defaults", "", nil, func(t *testing.T, c *Config) {
+			if c.Mode != SingleMode || len(c.Switches) != 1 || c.Switches[0].Name != "default" {
+				t.Errorf("Load() = %+v, want the default switch in single mode", c)
+			}
+		}, ""},
+		{"file normalized", twoSwitches, nil, func(t *testing.T, c *Config) {
+			if c.Mode != HAMode || c.HTTP.URL != "http://cti:7700" || c.Switches[0].Extensions[0].Type != VDN {
+				t.Errorf("Load() = %+v, want the normalized file", c)
+			}
+		}, ""},
+		{"env overrides the only switch", "", map[string]string{
+			"PROVIDER_HOST":        "aes:4722",
+			"SESSION_DURATION":     "300",
+			"MONITORED_EXTENSIONS": "5000:vdn, 100:skill",
+			"ROUTING_DEVICES":      "6000, ,6001",
+			"PROVIDER_TLS":         "true",
+			"REDACT_DIGITS":        "true",
+			"API_KEYS":             "ops:key:monitor-admin|read-only",
+		}, func(t *testing.T, c *Config) {
+			s := c.Switches[0]
+			if s.ProviderHost != "aes:4722" || s.SessionDuration != 300 || !s.TLS.Enabled || !c.RedactDigits {
+				t.Errorf("Load() switch = %+v", s)
+			}
+			if want := []ExtensionConfig{{ID: "5000", Type: VDN}, {ID: "100", Type: Skill}}; !reflect.DeepEqual(s.Extensions, want) {
+				t.Errorf("Load() extensions = %v, want %v", s.Extensions, want)
+			}
+			if want := []string{"6000", "6001"}; !reflect.DeepEqual(s.RoutingDevices, want) {
+				t.Errorf("Load() routing devices = %v, want %v", s.RoutingDevices, want)
+			}
+			if len(c.Auth.Keys) != 1 || c.Auth.Keys[0].Name != "ops" {
+				t.Errorf("Load() keys = %v", c.Auth.Keys)
+			}
+		}, ""},
+		{"env overrides the named switch", twoSwitches, map[string]string{"SWITCH_NAME": "west", "PBX_HOST": "cm-west-2"}, func(t *testing.T, c *Config) {
+			if c.Switches[0].PBX != "cm-east" || c.Switches[1].PBX != "cm-west-2" {
+				t.Errorf("Load() switches = %+v", c.Switches)
+			}
+		}, ""},
+		{"env override without switch name", twoSwitches, map[string]string{"PBX_HOST": "cm"}, nil, "PBX_HOST requires SWITCH_NAME"},
+		{"invalid duration", "", map[string]string{"SESSION_DURATION": "5m"}, nil, "SESSION_DURATION must be a number of seconds"},
+		{"invalid boolean", "", map[string]string{"PROVIDER_TLS": "yes"}, nil, "PROVIDER_TLS must be true or false"},
+		{"unknown field", "switches:\n  - name: east\n    host: aes:4721\n", nil, nil, "field host not found"},
+		{"invalid result", "", map[string]string{"CLUSTER_MODE": "cluster"}, nil, `mode "cluster"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			if tt.file != "" {
+				t.Setenv("CONFIG_FILE", writeFile(t, "config.yaml", tt.file))
+			}
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			c, err := Load()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			tt.check(t, c)
+		})
+	}
+}
+
+func TestLoadSwitchesFile(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("SWITCHES_FILE", writeFile(t, "switches.json",
+		`[{"name":"east","provider":"aes:4721","pbx":"cm","user":"cti","password":"secret"}]`))
+	c, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(c.Switches) != 1 || c.Switches[0].Name != "east" {
+		t.Errorf("Load() switches = %+v", c.Switches)
+	}
+}
+
+// TestLoadExample the example mounted as the configuration by the compose files
+func TestLoadExample(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("CONFIG_FILE", filepath.Join("..", "config.example.yaml"))
+	c, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(c.Switches) != 2 || len(c.Auth.Keys) != 0 {
+		t.Errorf("Load() switches = %+v, keys = %v", c.Switches, c.Auth.Keys)
+	}
+}
+
+func TestParseExtensions(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []ExtensionConfig
+		wantErr bool
+	}{
+		{"single", "5000:VDN", []ExtensionConfig{{ID: "5000", Type: "VDN"}}, false},
+		{"spaces and empty entries", " 5000 : VDN ,, 100:SKILL", []ExtensionConfig{{ID: "5000", Type: "VDN"}, {ID: "100", Type: "SKILL"}}, false},
+		{"empty", "", nil, false},
+		{"missing type", "5000", nil, true},
+		{"empty type", "5000:", nil, true},
+		{"too many parts", "5000:VDN:x", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseExtensions(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseExtensions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseExtensions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAPIKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []APIKeyConfig
+		wantErr bool
+	}{
+		{"roles", "ops:k1:monitor-admin|read-only", []APIKeyConfig{{Name: "ops", Key: "k1", Roles: []string{"monitor-admin", "read-only"}}}, false},
+		{"extensions", "agent:k2:call-control:1000|1001", []APIKeyConfig{{Name: "agent", Key: "k2", Roles: []string{"call-control"}, Extensions: []string{"1000", "1001"}}}, false},
+		{"empty extensions", "agent:k2:call-control:", []APIKeyConfig{{Name: "agent", Key: "k2", Roles: []string{"call-control"}}}, false},
+		{"missing roles", "ops:k1", nil, true},
+		{"empty key", "ops::read-only", nil, true},
+		{"too many parts", "ops:k1:read-only:1000:x", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAPIKeys(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAPIKeys() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseAPIKeys() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		tls     TLSConfig
+		wantNil bool
+		wantErr bool
+	}{
+		{"disabled", TLSConfig{}, true, false},
+		{"system CAs", TLSConfig{Enabled: true, ServerName: "aes"}, false, false},
+		{"min version", TLSConfig{Enabled: true, MinVersion: "1.0"}, false, false},
+		{"unknown min version", TLSConfig{Enabled: true, MinVersion: "1.4"}, false, true},
+		{"missing CA file", TLSConfig{Enabled: true, CAFile: filepath.Join(t.TempDir(), "ca.pem")}, false, true},
+		{"CA file without certificate", TLSConfig{Enabled: true, CAFile: writeFile(t, "ca.pem", "not a certificate")}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.tls.Config()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Config() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (got == nil) != tt.wantNil {
+				t.Errorf("Config() = %v, wantNil %v", got, tt.wantNil)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// tlsVersions accepted as minimum version of the provider connection
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// defaultTLSVersion minimum version when none is configured
+const defaultTLSVersion = "1.2"
+
+// TLSConfig of the connection to the CTI provider, the system CAs verify the provider without a CA file
+// and the server name defaults to the host of the provider
+type TLSConfig struct {
+	Enabled    bool   `yaml:"enabled" json:"enabled"`
+	CAFile     string `yaml:"caFile" json:"caFile"`
+	CertFile   string `yaml:"certFile" json:"certFile"`
+	KeyFile    string `yaml:"keyFile" json:"keyFile"`
+	ServerName string `yaml:"serverName" json:"serverName"`
+	MinVersion string `yaml:"minVersion" json:"minVersion"`
+}
+
+// Config of the TLS connection, nil when TLS is disabled. The files are read on each call
+// so that a reconnection picks up the renewed certificates
+func (c TLSConfig) Config() (*tls.Config, error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+	version, ok := tlsVersions[c.minVersion()]
+	if !ok {
+		return nil, fmt.Errorf("tls.minVersion %q must be 1.0, 1.1, 1.2 or 1.3", c.MinVersion)
+	}
+	config := &tls.Config{ServerName: c.ServerName, MinVersion: version}
+	if c.CAFile != "" {
+		data, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls.caFile: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("tls.caFile %s has no PEM certificate", c.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls.certFile and tls.keyFile: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+func (c TLSConfig) minVersion() string {
+	if c.MinVersion == "" {
+		return defaultTLSVersion
+	}
+	return c.MinVersion
+}
+
+// validateTLS settings without reading the files, which may only exist where the provider is connected
+func validateTLS(e *ValidationError, prefix string, c TLSConfig) {
+	if !c.Enabled {
+		return
+	}
+	if _, ok := tlsVersions[c.minVersion()]; !ok {
+		e.add("%s: tls.minVersion %q must be 1.0, 1.1, 1.2 or 1.3", prefix, c.MinVersion)
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		e.add("%s: tls.certFile and tls.keyFile are required together", prefix)
+	}
+}
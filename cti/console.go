@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rresender/csta-integration/cti/auth"
+	"github.com/rresender/csta-integration/cti/logger"
+	"github.com/rresender/csta-integration/cti/provider"
+)
+
+const (
+	// consoleQueueID of the requests sent through the console
+	consoleQueueID = "console"
+	// maxConsoleRequest size of a request sent through the console
+	maxConsoleRequest = 64 * 1024
+	// watcherBuffer events kept for a slow watcher before dropping them
+	watcherBuffer = 64
+)
+
+var crossRefIDPattern = regexp.MustCompile(`<monitorCrossRefID>([^<]*)</monitorCrossRefID>`)
+
+// ConsoleResult correlated response of a request sent through the console
+type ConsoleResult struct {
+	Switch   string        `json:"switch"`
+	InvokeID string        `json:"invokeID"`
+	Request  string        `json:"request"`
+	Response string        `json:"response"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// ConsoleEvent unsolicited event received for a watched monitor
+type ConsoleEvent struct {
+	Time              time.Time `json:"time"`
+	Name              string    `json:"name"`
+	MonitorCrossRefID string    `json:"monitorCrossRefID"`
+	Data              string    `json:"data"`
+}
+
+type watcher struct {
+	switchName        string
+	monitorCrossRefID string
+	events            chan ConsoleEvent
+}
+
+var (
+	watchers     = make(map[*watcher]bool)
+	watchersLock sync.RWMutex
+)
+
+// authorizeConsole requires an identity with every role and no extension restriction or, without authentication,
+// the console token as a bearer token, the console is disabled otherwise
+func authorizeConsole(w http.ResponseWriter, r *http.Request) bool {
+	if authenticator.Enabled() {
+		if identity := auth.FromContext(r.Context()); identity.Restricted() {
+			http.Error(w, "the console requires an identity without extension restrictions", http.StatusForbidden)
+			return false
+		}
+		return true
+	}
+	token := currentConfig().HTTP.ConsoleToken
+	if token == "" {
+		http.Error(w, "the console is disabled", http.StatusNotFound)
+		return false
+	}
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "a valid console token is required", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// validateRequest well formed XML with a single root element
+func validateRequest(message string) error {
+	decoder := xml.NewDecoder(strings.NewReader(message))
+	roots := 0
+	depth := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("request is not valid XML: %v", err)
+		}
+		switch token.(type) {
+		case xml.StartElement:
+			if depth == 0 {
+				roots++
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+	if roots != 1 {
+		return errors.New("request must have a single root element")
+	}
+	return nil
+}
+
+// consoleRequest sends a raw CSTA request over the session and returns its correlated response
+func (s *Switch) consoleRequest(message string) (*ConsoleResult, error) {
+	message = strings.TrimSpace(message)
+	if err := validateRequest(message); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	invokeID, data, err := s.exchange(consoleQueueID, message)
+	result := &ConsoleResult{Switch: s.Name, InvokeID: invokeID, Request: logger.Redact(message), Response: logger.Redact(data), Duration: time.Since(start)}
+	s.log.Info("console request", "invokeID", invokeID, "request", provider.MessageName(message), "response", provider.MessageName(data), "error", err)
+	if err != nil {
+		return result, err
+	}
+	if err := provider.ResponseError(data); err != nil {
+		result.Error = err.Error()
+	}
+	return result, nil
+}
+
+// notifyWatchers of the monitor of an unsolicited event
+func (s *Switch) notifyWatchers(name string, data string) {
+	watchersLock.RLock()
+	defer watchersLock.RUnlock()
+	if len(watchers) == 0 {
+		return
+	}
+	match := crossRefIDPattern.FindStringSubmatch(data)
+	if match == nil {
+		return
+	}
+	event := ConsoleEvent{Time: time.Now(), Name: name, MonitorCrossRefID: match[1], Data: logger.Redact(data)}
+	for w := range watchers {
+		if w.switchName != s.Name || w.monitorCrossRefID != event.MonitorCrossRefID {
+			continue
+		}
+		select {
+		case w.events <- event:
+		default:
+			s.log.Warn("console watcher is too slow, the event has been dropped", "monitorCrossRefID", event.MonitorCrossRefID, "event", name)
+		}
+	}
+}
+
+// watchEvents streams the raw unsolicited events of a monitor as newline delimited JSON until the client goes away
+func (s *Switch) watchEvents(w http.ResponseWriter, r *http.Request, monitorCrossRefID string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	watch := &watcher{switchName: s.Name, monitorCrossRefID: monitorCrossRefID, events: make(chan ConsoleEvent, watcherBuffer)}
+	watchersLock.Lock()
+	watchers[watch] = true
+	watchersLock.Unlock()
+	defer func() {
+		watchersLock.Lock()
+		delete(watchers, watch)
+		watchersLock.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	encoder := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-watch.events:
+			encoder.Encode(event)
+			flusher.Flush()
+		}
+	}
+}
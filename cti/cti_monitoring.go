@@ -1,152 +1,186 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/rresender/csta-integration/cti/config"
 	"github.com/rresender/csta-integration/cti/db"
 	"github.com/rresender/csta-integration/cti/helper"
+	"github.com/rresender/csta-integration/cti/logger"
 	"github.com/rresender/csta-integration/cti/provider"
 	"github.com/rresender/csta-integration/cti/rabbitmq"
 	"github.com/rresender/csta-integration/cti/redis"
 
-	xj "github.com/basgys/goxml2json"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+var log = logger.New("cti")
+
 var (
 	applicationName string
-	provider_host   string
-	pbx             string
-	user            string
-	password        string
-	extensionsMap   map[string]*db.Extension
+	clusterMode     string
+	switches        []*Switch
+)
+
+// applicationPrefix of the application name of every instance, followed by its IP address
+const applicationPrefix = "provider-monitoring-"
+
+const (
+	singleMode  = config.SingleMode
+	haMode      = config.HAMode
+	shardedMode = config.ShardedMode
 )
 
+// runningConfig of the service, replaced by the reloads while the API reads it
+var runningConfig atomic.Pointer[config.Config]
+
+// currentConfig of the service, to be read again by each use after the startup
+func currentConfig() *config.Config {
+	return runningConfig.Load()
+}
+
 // UnsolicitedInvokeID generic InvokeID for unsolicited events
 var UnsolicitedInvokeID = strconv.Itoa(db.MaxInvokeID)
 
-func init() {
-	applicationName = "provider-monitoring-" + helper.GetLocalIP()
+// setup the configuration, the connections and the switches of the service
+func setup() {
+	applicationName = applicationPrefix + helper.GetLocalIP()
 
-	provider_host = os.Getenv("PROVIDER_HOST")
-	if provider_host == "" {
-		provider_host = "localhost:4721"
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal("configuration could not be loaded", "error", err)
 	}
-	pbx = os.Getenv("PBX_HOST")
-	if pbx == "" {
-		pbx = "localhost"
+	runningConfig.Store(cfg)
+	clusterMode = cfg.Mode
+
+	redis.Connect(cfg.Redis.Host)
+	rabbitmq.Connect(cfg.RabbitMQ.URL())
+
+	for _, c := range cfg.Switches {
+		if _, err := c.TLS.Config(); err != nil {
+			log.Fatal("TLS of the provider connection could not be configured", "switch", c.Name, "error", err)
+		}
+		s := &Switch{SwitchConfig: c}
+		s.init(applicationName)
+		switches = append(switches, s)
 	}
-	user = os.Getenv("CTI_USER")
-	if user == "" {
-		user = "ctiuser"
+
+	if authenticator, err = cfg.Auth.Authenticator(); err != nil {
+		log.Fatal("authentication could not be configured", "error", err)
 	}
-	password = os.Getenv("CTI_PASSWORD")
-	if password == "" {
-		password = "ctipassword"
+	if !authenticator.Enabled() {
+		log.Warn("the API is not authenticated: configure API keys or a JWT secret")
 	}
-	extensionsAndTypes := strings.Split(os.Getenv("MONITORED_EXTENSIONS"), ",")
-	if len(extensionsAndTypes) > 1 {
-		extensionsMap = make(map[string]*db.Extension)
-		for i := range extensionsAndTypes {
-			extensionAndType := strings.Split(extensionsAndTypes[i], ":")
-			ID := strings.TrimSpace(extensionAndType[0])
-			extType := strings.TrimSpace(extensionAndType[1])
-			extensionsMap[ID] = &db.Extension{ID: ID, Type: extType}
-		}
+
+	if router, err = newRouter(cfg.Routing); err != nil {
+		log.Fatal("router could not be configured", "error", err)
 	}
-}
 
-//Handler event listener
-type Handler struct{}
+	provider.SetDigitsRedaction(cfg.RedactDigits)
+}
 
-func readResponse(invokeID string, appName string) string {
-	responseDataReceivedTicker := time.Tick(time.Second * 2)
-	for {
-		select {
-		case <-responseDataReceivedTicker:
-			data := db.Find(helper.GetInvokeIDKey(invokeID, appName))
-			if data == "" {
-				continue
-			}
-			return data
+// getSwitch from the "switch" query parameter, the first switch by default
+func getSwitch(r *http.Request) (*Switch, error) {
+	name := r.URL.Query().Get("switch")
+	if name == "" {
+		return switches[0], nil
+	}
+	for _, s := range switches {
+		if s.Name == name {
+			return s, nil
 		}
 	}
+	return nil, fmt.Errorf("switch %s is not configured", name)
 }
 
-func heartbeat(sessionID string, appName string) {
-	go func() {
-		heartbeatTicker := time.Tick(time.Second * 30)
-		invokeID := db.GetInvoke("heartbeat", appName)
-		for {
-			select {
-			case <-heartbeatTicker:
-				provider.Send(invokeID, provider.ResetApplicationSessionTimerMessage(sessionID))
-				data := readResponse(invokeID, appName)
-				var response provider.ResetApplicationSessionTimerResponse
-				provider.ParseMessageResponse(data, &response)
-				if err := provider.ParseMessageResponse(data, &response); err != nil {
-					log.Println(err)
-				}
-				db.Delete(helper.GetQueueKey(invokeID, appName))
-			}
-		}
-	}()
+// getActiveSwitch writes the error response when the switch is not handled by this instance
+func getActiveSwitch(w http.ResponseWriter, r *http.Request) *Switch {
+	s, err := getSwitch(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+	if !s.isActive() {
+		http.Error(w, fmt.Sprintf("switch %s is handled by %s", s.Name, db.GetLeader(s.Name)), http.StatusServiceUnavailable)
+		return nil
+	}
+	return s
 }
 
-// DoProcess process responses from provider_host
-func (h Handler) DoProcess(invokeID string, data string) {
-	switch invokeID {
-	case UnsolicitedInvokeID:
-		converted, _ := xj.Convert(bytes.NewBufferString(data))
-		var in map[string]interface{}
-		json.Unmarshal(converted.Bytes(), &in)
-		out := make(map[string]string)
-		helper.ParseJSON(in, out)
-		monitorCrossRefID := out["monitorCrossRefID"]
-		queue := db.Find(helper.GetMonitorCrossRefIDKey(monitorCrossRefID, applicationName))
-		rabbitmq.Send(queue, converted)
-	default:
-		db.SaveWithTTL(helper.GetInvokeIDKey(invokeID, applicationName), data)
-	}
+// Errors of the requests mapped to their HTTP status by httpStatus
+var (
+	// errResponseTimeout the provider did not answer the request in time
+	errResponseTimeout = errors.New("no response")
+	// errNotConnected the provider connection of the switch is not established
+	errNotConnected = errors.New("the provider is not connected")
+	// errNotMonitored the extension is not monitored by the switch
+	errNotMonitored = errors.New("extension could not be found")
+)
+
+// requestError parameter of a request of the API that is not valid
+type requestError struct {
+	err error
 }
 
-func stopMonitoring(extension string, appName string) (*db.Extension, error) {
-	ext := db.FindExtension(extension)
-	if ext == nil {
-		return nil, errors.New("extension could not be found")
-	}
-	invokeID := db.GetInvoke(extension, appName)
+func (e *requestError) Error() string {
+	return e.err.Error()
+}
 
-	provider.Send(invokeID, provider.MonitorStopMessage(ext.MonitorCrossRefID))
-	data := readResponse(invokeID, appName)
+func (e *requestError) Unwrap() error {
+	return e.err
+}
 
-	var response provider.MonitorStopResponse
-	var err error
-	if err = provider.ParseMessageResponse(data, &response); err != nil {
-		log.Println(err)
+// invalidRequest marks the error as a parameter that is not valid, nil without error
+func invalidRequest(err error) error {
+	if err == nil {
+		return nil
 	}
+	return &requestError{err: err}
+}
 
-	db.RemoveExtensionFromList(extension)
-	db.Delete(extension)
-	db.Delete(helper.GetMonitorCrossRefIDKey(ext.MonitorCrossRefID, appName))
-	delete(extensionsMap, ext.ID)
-	return ext, err
+// httpStatus of the error returned by a request: 400 for the parameters and the requests rejected by the provider,
+// 503 without provider session, 504 without its response in time and 500 for the other errors
+func httpStatus(err error) int {
+	var reqErr *requestError
+	var cstaErr *provider.CSTAError
+	var sessionErr *provider.SessionError
+	switch {
+	case errors.As(err, &reqErr):
+		return http.StatusBadRequest
+	case errors.Is(err, errResponseTimeout):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, errNotConnected), errors.As(err, &sessionErr):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, errNotMonitored), errors.Is(err, provider.ErrInvalidDevice), errors.Is(err, provider.ErrInvalidCall):
+		return http.StatusNotFound
+	case errors.Is(err, provider.ErrNotAllowed), errors.Is(err, provider.ErrSecurity):
+		return http.StatusForbidden
+	case errors.Is(err, provider.ErrResourceBusy), errors.Is(err, provider.ErrStateIncompatibility):
+		return http.StatusConflict
+	case errors.Is(err, provider.ErrSystemResourceAvailability), errors.Is(err, provider.ErrSubscribedResourceAvailability),
+		errors.Is(err, provider.ErrPerformanceManagement):
+		return http.StatusServiceUnavailable
+	case errors.As(err, &cstaErr):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
 }
 
-func cleanUpHook(sessionID string, appName string) {
+func cleanUpHook() {
 
-	defer provider.Close()
 	defer redis.Close()
 	defer rabbitmq.Close()
 
@@ -157,195 +191,512 @@ func cleanUpHook(sessionID string, appName string) {
 		err <- fmt.Errorf("signal %v", <-c)
 	}()
 
-	log.Println("Cleaning up... :", <-err)
-
-	for _, extension := range extensionsMap {
-		stopMonitoring(extension.ID, appName)
-	}
-
-	if sessionID != "" {
-		invokeID := db.GetInvoke(appName, appName)
-		provider.Send(invokeID, provider.StopAppSessionMessage(sessionID))
-		data := readResponse(invokeID, appName)
-		var response provider.StartApplicationSessionResponse
-		if err := provider.ParseMessageResponse(data, &response); err != nil {
-			log.Println(err)
-		}
+	log.Info("cleaning up", "reason", <-err)
+
+	var wg sync.WaitGroup
+	for _, s := range switches {
+		wg.Add(1)
+		go func(s *Switch) {
+			defer wg.Done()
+			close(s.done)
+			switch clusterMode {
+			case haMode:
+				s.resign()
+			case shardedMode:
+				s.leave()
+			default:
+				s.cleanUp()
+			}
+		}(s)
 	}
+	wg.Wait()
 }
 
-func startSession(appName string, user string, password string, sessionCleanupDelay string, requestedSessionDuration string) (string, error) {
-
-	invokeID := db.GetInvoke(appName, appName)
+func httpHandler() {
+	go func() {
+		m := mux.NewRouter()
+		m.Use(authorize)
+		m.HandleFunc("/start/{type}/{extension}", func(w http.ResponseWriter, r *http.Request) {
 
-	provider.Send(invokeID, provider.StartApplicationSessionMessage(appName, user, password, sessionCleanupDelay, requestedSessionDuration))
-	session := readResponse(invokeID, appName)
+			vars := mux.Vars(r)
+			extension := vars["extension"]
+			extType := vars["type"]
 
-	var response provider.StartApplicationSessionResponse
-	if err := provider.ParseMessageResponse(session, &response); err != nil {
-		return "", err
-	}
-	log.Printf("SessionID: %s\n", response.SessionID)
-	return response.SessionID, nil
-}
+			s := getActiveSwitch(w, r)
+			if s == nil {
+				return
+			}
 
-func getDeviceID(extension string, pbx string, appName string) (string, error) {
+			if clusterMode == shardedMode {
+				extType = strings.ToUpper(extType)
+				if extType != "VDN" && extType != "SKILL" {
+					http.Error(w, fmt.Sprintf("type %s is not valid", extType), http.StatusBadRequest)
+					return
+				}
+				db.AddDesiredExtension(s.Name, extension, extType)
+				if o := owner(extension, db.GetMembers(s.Name, leaseTTL)); o != instanceID {
+					auditRequest(r, "monitor.start", s.Name, extension, map[string]string{"type": extType, "owner": o}, nil)
+					fmt.Fprintf(w, "Monitoring on %s: %s has been assigned to %s on %s", extType, extension, o, s.Name)
+					return
+				}
+			}
 
-	invokeID := db.GetInvoke(extension, appName)
+			ext, err := s.doMonitoring(extension, extType)
+			auditRequest(r, "monitor.start", s.Name, extension, map[string]string{"type": extType}, err)
 
-	provider.Send(invokeID, provider.GetDeviceIDMessage(pbx, extension))
-	device := readResponse(invokeID, appName)
+			if err != nil {
+				http.Error(w, err.Error(), httpStatus(err))
+				rabbitmq.DeleteQueue(helper.GetExchangeName(s.Name, extension))
+				return
+			}
 
-	var response provider.GetDeviceIDResponse
-	if err := provider.ParseMessageResponse(device, &response); err != nil {
-		return "", err
-	}
-	log.Printf("DeviceID: %s\n", response.Device.ID)
+			fmt.Fprintf(w, "Monitoring on %s: %s (MonitorCrossRefID: %s) has been started on %s", extType, extension, ext.MonitorCrossRefID, s.Name)
+		})
 
-	return response.Device.ID, nil
-}
+		m.HandleFunc("/stop/{extension}", func(w http.ResponseWriter, r *http.Request) {
 
-func getMonitorCrossRefID(invokeID string, extension string, appName string) (string, error) {
+			vars := mux.Vars(r)
+			extension := vars["extension"]
 
-	monitorCrossRefID := readResponse(invokeID, appName)
+			s := getActiveSwitch(w, r)
+			if s == nil {
+				return
+			}
 
-	var response provider.MonitorStartResponse
-	if err := provider.ParseMessageResponse(monitorCrossRefID, &response); err != nil {
-		return "", err
-	}
-	log.Printf("MonitorCrossRefID: %s\n", response.MonitorCrossRefID)
+			if clusterMode == shardedMode {
+				db.RemoveDesiredExtension(s.Name, extension)
+				auditRequest(r, "monitor.stop", s.Name, extension, nil, nil)
+				ext := s.getExtension(extension)
+				if ext == nil {
+					fmt.Fprintf(w, "Monitoring on %s will be stopped by its owner on %s", extension, s.Name)
+					return
+				}
+				s.releaseMonitor(ext)
+				fmt.Fprintf(w, "Monitoring on %s (MonitorCrossRefID: %s) has been stopped on %s", extension, ext.MonitorCrossRefID, s.Name)
+				return
+			}
 
-	db.Save(helper.GetMonitorCrossRefIDKey(response.MonitorCrossRefID, appName), extension)
-	return response.MonitorCrossRefID, nil
-}
+			ext, err := s.stopMonitoring(extension)
+			if err == nil && ext == nil {
+				auditRequest(r, "monitor.stop", s.Name, extension, nil, fmt.Errorf("extension: %s has not been monitored", extension))
+			} else {
+				auditRequest(r, "monitor.stop", s.Name, extension, nil, err)
+			}
+			if err != nil {
+				http.Error(w, err.Error(), httpStatus(err))
+				return
+			}
 
-func startVDNMonitoring(extension string, pbx string, appName string) (*db.Extension, error) {
-	deviceID, err := getDeviceID(extension, pbx, appName)
-	if err != nil {
-		return nil, err
-	}
-	invokeID := db.GetInvoke(extension, appName)
-	provider.Send(invokeID, provider.MonitorVDNStartMessage(deviceID))
-	monitorCrossRefID, err := getMonitorCrossRefID(invokeID, extension, appName)
-	return &db.Extension{ID: extension, Type: "VDN", DeviceID: deviceID, MonitorCrossRefID: monitorCrossRefID}, err
-}
+			if ext == nil {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, "extension: %s has not been monitored", extension)
+				return
+			}
 
-func startSkillMonitoring(extension string, pbx string, appName string) (*db.Extension, error) {
-	deviceID, err := getDeviceID(extension, pbx, appName)
-	if err != nil {
-		return nil, err
-	}
-	invokeID := db.GetInvoke(extension, appName)
-	provider.Send(invokeID, provider.MonitorSkillStartMessage(deviceID))
-	monitorCrossRefID, err := getMonitorCrossRefID(invokeID, extension, appName)
-	return &db.Extension{ID: extension, Type: "SKILL", DeviceID: deviceID, MonitorCrossRefID: monitorCrossRefID}, err
-}
+			fmt.Fprintf(w, "Monitoring on %s (MonitorCrossRefID: %s) has been stopped on %s", extension, ext.MonitorCrossRefID, s.Name)
 
-func doMonitoring(extension string, extType string, appName string) (*db.Extension, error) {
-	if db.Exists(extension) {
-		log.Printf("the extension %s is already being monitored. The monitoring process will be restarted...\n", extension)
-		stopMonitoring(extension, appName)
-	}
-	var ext *db.Extension
-	var err error
-	extType = strings.ToUpper(extType)
-	switch extType {
-	case "VDN":
-		ext, err = startVDNMonitoring(extension, pbx, appName)
-	case "SKILL":
-		ext, err = startSkillMonitoring(extension, pbx, appName)
-	default:
-		err = fmt.Errorf("type %s is not valid", extType)
-	}
-	if err == nil {
-		db.AddExtensionToList(ext.ID)
-		db.SaveExtension(ext)
-		extensionsMap[ext.ID] = ext
-	}
-	return ext, err
-}
+		})
 
-func httpHandler(pbx string, appName string) {
-	go func() {
-		m := mux.NewRouter()
-		m.HandleFunc("/start/{type}/{extension}", func(w http.ResponseWriter, r *http.Request) {
+		m.HandleFunc("/snapshot/{extension}", func(w http.ResponseWriter, r *http.Request) {
 
 			vars := mux.Vars(r)
 			extension := vars["extension"]
-			extType := vars["type"]
 
-			ext, err := doMonitoring(extension, extType, appName)
+			s := getActiveSwitch(w, r)
+			if s == nil {
+				return
+			}
 
+			ext := s.getExtension(extension)
+			if ext == nil {
+				http.Error(w, fmt.Sprintf("extension: %s is not monitored by %s on %s", extension, instanceID, s.Name), http.StatusNotFound)
+				return
+			}
+
+			snapshot, err := s.publishSnapshot(ext)
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				rabbitmq.DeleteQueue(extension)
+				http.Error(w, err.Error(), httpStatus(err))
 				return
 			}
 
-			fmt.Fprintf(w, "Monitoring on %s: %s (MonitorCrossRefID: %s) has been started", extType, extension, ext.MonitorCrossRefID)
+			fmt.Fprintf(w, "Snapshot of %s on %s has been published: %d calls in progress\n", extension, s.Name, len(snapshot.Calls))
+			for _, call := range snapshot.Calls {
+				fmt.Fprintf(w, "%s (UCID: %s, calling: %s, called: %s, state: %s)\n", call.CallID, call.UCID, call.CallingDevice, call.CalledDevice, call.State)
+			}
 		})
 
-		m.HandleFunc("/stop/{extension}", func(w http.ResponseWriter, r *http.Request) {
+		m.HandleFunc("/devices/{extension}", func(w http.ResponseWriter, r *http.Request) {
+
+			vars := mux.Vars(r)
+			extension := vars["extension"]
+
+			s := getActiveSwitch(w, r)
+			if s == nil {
+				return
+			}
+
+			state, err := s.getDeviceState(extension)
+			if err != nil {
+				http.Error(w, err.Error(), httpStatus(err))
+				return
+			}
+
+			fmt.Fprintf(w, "Device %s on %s (DeviceID: %s)\n", extension, s.Name, state.DeviceID)
+			if state.InfoErr != nil {
+				fmt.Fprintf(w, "info: %v\n", state.InfoErr)
+			} else {
+				fmt.Fprintf(w, "info: category: %s, model: %s, class: %s, max active calls: %d, max held calls: %d\n",
+					state.Info.DeviceCategory, state.Info.ModelName, state.Info.AssociatedClass, state.Info.MaxActiveCalls, state.Info.MaxHeldCalls)
+			}
+			if state.DoNotDisturbErr != nil {
+				fmt.Fprintf(w, "do not disturb: %v\n", state.DoNotDisturbErr)
+			} else {
+				fmt.Fprintf(w, "do not disturb: %t\n", state.DoNotDisturb)
+			}
+			if state.MessageWaitingErr != nil {
+				fmt.Fprintf(w, "message waiting indicator: %v\n", state.MessageWaitingErr)
+			} else {
+				fmt.Fprintf(w, "message waiting indicator: %t\n", state.MessageWaiting)
+			}
+			if state.ForwardingErr != nil {
+				fmt.Fprintf(w, "forwarding: %v\n", state.ForwardingErr)
+			} else {
+				fmt.Fprintf(w, "forwarding: %d\n", len(state.Forwarding))
+				for _, f := range state.Forwarding {
+					fmt.Fprintf(w, "%s: %t %s\n", f.ForwardingType, f.ForwardStatus, f.ForwardDN)
+				}
+			}
+		}).Methods("GET")
+
+		m.HandleFunc("/devices/{extension}/{feature}", func(w http.ResponseWriter, r *http.Request) {
 
 			vars := mux.Vars(r)
 			extension := vars["extension"]
+			feature := vars["feature"]
 
-			ext, err := stopMonitoring(extension, appName)
+			on, err := strconv.ParseBool(r.URL.Query().Get("on"))
+			if err != nil {
+				http.Error(w, "on must be true or false", http.StatusBadRequest)
+				return
+			}
+
+			s := getActiveSwitch(w, r)
+			if s == nil {
+				return
+			}
+
+			params := map[string]string{"on": strconv.FormatBool(on)}
+			switch feature {
+			case "donotdisturb":
+				err = s.setDoNotDisturb(extension, on)
+			case "forwarding":
+				forwardingType := r.URL.Query().Get("type")
+				if forwardingType == "" {
+					forwardingType = "forwardImmediate"
+				}
+				params["type"], params["destination"] = forwardingType, r.URL.Query().Get("destination")
+				err = s.setForwarding(extension, forwardingType, on, params["destination"])
+			case "mwi":
+				err = s.setMessageWaitingIndicator(extension, on)
+			default:
+				http.Error(w, fmt.Sprintf("feature %s is not valid", feature), http.StatusNotFound)
+				return
+			}
+			auditRequest(r, "device."+feature, s.Name, extension, params, err)
+			if err != nil {
+				http.Error(w, err.Error(), httpStatus(err))
+				return
+			}
+
+			fmt.Fprintf(w, "%s of %s has been set to %t on %s", feature, extension, on, s.Name)
+		}).Methods("POST")
+
+		m.HandleFunc("/digits/{extension}", func(w http.ResponseWriter, r *http.Request) {
+
+			vars := mux.Vars(r)
+			extension := vars["extension"]
+			callID := r.FormValue("callID")
+
+			s := getActiveSwitch(w, r)
+			if s == nil {
+				return
+			}
+
+			digits := r.FormValue("digits")
+			err := s.generateDigits(extension, callID, digits)
+			auditRequest(r, "call.digits", s.Name, extension, map[string]string{"callID": callID, "digits": provider.MaskDigits(digits)}, err)
+			if err != nil {
+				http.Error(w, err.Error(), httpStatus(err))
+				return
+			}
+
+			fmt.Fprintf(w, "Digits have been generated on the call %s of %s on %s", callID, extension, s.Name)
+		}).Methods("POST")
+
+		m.HandleFunc("/calls/{extension}/{action}", func(w http.ResponseWriter, r *http.Request) {
+
+			vars := mux.Vars(r)
+			extension := vars["extension"]
+			command := &CallCommand{
+				Action:      vars["action"],
+				CallID:      r.FormValue("callID"),
+				Destination: r.FormValue("destination"),
+				UUI:         r.FormValue("uui"),
+				UUIFormat:   r.FormValue("uuiFormat"),
+			}
+
+			s := getActiveSwitch(w, r)
+			if s == nil {
+				return
+			}
+
+			result, err := s.callControl(extension, command)
+			params := map[string]string{"callID": command.CallID, "destination": command.Destination, "uui": command.UUI, "uuiFormat": command.UUIFormat}
+			if result != nil && result.CallID != "" {
+				params["callID"] = result.CallID
+			}
+			auditRequest(r, "call."+command.Action, s.Name, extension, params, err)
+			if err != nil {
+				http.Error(w, err.Error(), httpStatus(err))
+				return
+			}
+
+			fmt.Fprintf(w, "%s has been requested on the call %s of %s on %s", command.Action, result.CallID, extension, s.Name)
+		}).Methods("POST")
+
+		m.HandleFunc("/events/{extension}", func(w http.ResponseWriter, r *http.Request) {
+			s, err := getSwitch(r)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
+			streamEvents(w, r, helper.GetExchangeName(s.Name, mux.Vars(r)["extension"]))
+		}).Methods("GET")
+
+		m.HandleFunc("/monitors", func(w http.ResponseWriter, r *http.Request) {
+			selected := switches
+			if r.URL.Query().Get("switch") != "" {
+				s, err := getSwitch(r)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				selected = []*Switch{s}
+			}
+			monitors := []*db.Extension{}
+			for _, s := range selected {
+				for _, ID := range allowedExtensions(r, db.GetAllExtensions(s.Name)) {
+					if ext := db.FindExtension(s.Name, ID); ext != nil {
+						monitors = append(monitors, ext)
+					}
+				}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(monitors)
+		}).Methods("GET")
 
-			if ext == nil {
-				w.WriteHeader(http.StatusBadRequest)
-				fmt.Fprintf(w, "extension: %s has not been monitored", extension)
+		m.HandleFunc("/console", func(w http.ResponseWriter, r *http.Request) {
+			if !authorizeConsole(w, r) {
 				return
 			}
 
-			fmt.Fprintf(w, "Monitoring on %s (MonitorCrossRefID: %s) has been stopped", extension, ext.MonitorCrossRefID)
+			s := getActiveSwitch(w, r)
+			if s == nil {
+				return
+			}
 
-		})
+			message, err := io.ReadAll(io.LimitReader(r.Body, maxConsoleRequest))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			result, err := s.consoleRequest(string(message))
+			params := map[string]string{"request": provider.MessageName(string(message))}
+			auditErr := err
+			if result != nil {
+				params["invokeID"] = result.InvokeID
+				if auditErr == nil && result.Error != "" {
+					auditErr = errors.New(result.Error)
+				}
+			}
+			auditRequest(r, "console.request", s.Name, "", params, auditErr)
+			if err != nil && result == nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				result.Error = err.Error()
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(result)
+		}).Methods("POST")
+
+		m.HandleFunc("/console/events/{monitorCrossRefID}", func(w http.ResponseWriter, r *http.Request) {
+			if !authorizeConsole(w, r) {
+				return
+			}
+
+			s := getActiveSwitch(w, r)
+			if s == nil {
+				return
+			}
+
+			s.watchEvents(w, r, mux.Vars(r)["monitorCrossRefID"])
+		}).Methods("GET")
 
 		m.HandleFunc("/getall", func(w http.ResponseWriter, r *http.Request) {
-			extensions := db.GetAllExtensions()
-			fmt.Fprintf(w, "List of extensions being monitored: %d\n", len(extensions))
-			for _, extension := range extensions {
-				fmt.Fprintln(w, extension)
+			selected := switches
+			if r.URL.Query().Get("switch") != "" {
+				s, err := getSwitch(r)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				selected = []*Switch{s}
+			}
+			for _, s := range selected {
+				extensions := allowedExtensions(r, db.GetAllExtensions(s.Name))
+				fmt.Fprintf(w, "List of extensions being monitored on %s: %d\n", s.Name, len(extensions))
+				for _, extension := range extensions {
+					fmt.Fprintln(w, extension)
+				}
 			}
 		})
 
-		log.Fatal(http.ListenAndServe(":7700", m))
-	}()
-}
+		m.HandleFunc("/switches", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "List of switches: %d\n", len(switches))
+			for _, s := range switches {
+				session := s.getSession()
+				fmt.Fprintf(w, "%s (provider: %s, pbx: %s, session: %s, duration: %v, last heartbeat: %s, restarts: %d, leader: %s)\n",
+					s.Name, s.ProviderHost, s.PBX, s.getSessionID(), session.Duration, session.LastHeartbeat.Format(time.RFC3339), session.Restarts, db.GetLeader(s.Name))
+			}
+		})
 
-func monitoringExtensions(appName string) {
-	go func() {
-		for ID, elem := range extensionsMap {
-			ext, err := doMonitoring(ID, elem.Type, appName)
+		m.HandleFunc("/reconciliation", func(w http.ResponseWriter, r *http.Request) {
+			s, err := getSwitch(r)
 			if err != nil {
-				log.Printf("%v\n", err)
-				rabbitmq.DeleteQueue(ID)
+				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
-			log.Printf("Monitoring on %s: %s (MonitorCrossRefID: %s) has been started\n", ext.Type, ext.ID, ext.MonitorCrossRefID)
-		}
+			summary := getReconciliation(s.Name)
+			if summary == nil {
+				http.Error(w, fmt.Sprintf("switch %s has not been reconciled", s.Name), http.StatusNotFound)
+				return
+			}
+			fmt.Fprintln(w, summary)
+		})
+
+		m.HandleFunc("/ownership", func(w http.ResponseWriter, r *http.Request) {
+			s, err := getSwitch(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			members, ownership := s.getOwnership()
+			fmt.Fprintf(w, "Members of the cluster of %s: %d\n", s.Name, len(members))
+			for _, member := range members {
+				fmt.Fprintln(w, member)
+			}
+			fmt.Fprintf(w, "Ownership of the extensions of %s: %d\n", s.Name, len(ownership))
+			for _, o := range ownership {
+				fmt.Fprintf(w, "%s (%s): %s (active: %t)\n", o.Extension, o.Type, o.Owner, o.Active)
+			}
+		})
+
+		m.HandleFunc("/reload", func(w http.ResponseWriter, r *http.Request) {
+			reloads, err := reload("requested by the API")
+			auditRequest(r, "config.reload", "", "", reloadParams("requested by the API", reloads), err)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			for _, summary := range reloads {
+				fmt.Fprintln(w, summary)
+			}
+		}).Methods("POST")
+
+		m.HandleFunc("/audit", func(w http.ResponseWriter, r *http.Request) {
+			q, err := parseAuditQuery(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			entries, err := queryAudit(q)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(entries)
+		}).Methods("GET")
+
+		m.HandleFunc("/audit/export", func(w http.ResponseWriter, r *http.Request) {
+			q, err := parseAuditQuery(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			exportAudit(w, q, r.URL.Query().Get("format"))
+		}).Methods("GET")
+
+		m.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+			health, ok := liveness()
+			writeHealth(w, health, ok)
+		})
+
+		m.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+			health, ok := readiness()
+			writeHealth(w, health, ok)
+		})
+
+		m.Handle("/metrics", promhttp.Handler())
+
+		log.Fatal("http server stopped", "error", http.ListenAndServe(currentConfig().HTTP.Address, m))
 	}()
 }
 
 func main() {
 
-	provider.Connect(provider_host, &Handler{})
+	setup()
 
-	sessionID, err := startSession(applicationName, user, password, "60", "180")
-	if err != nil {
-		log.Fatalln(err)
+	if clusterMode == haMode {
+		for _, s := range switches {
+			s.elect()
+		}
+		watchReload()
+		httpHandler()
+		cleanUpHook()
+		return
 	}
 
-	monitoringExtensions(applicationName)
-
-	heartbeat(sessionID, applicationName)
+	var wg sync.WaitGroup
+	for _, s := range switches {
+		wg.Add(1)
+		go func(s *Switch) {
+			defer wg.Done()
+			if clusterMode == shardedMode {
+				s.seedDesired()
+			}
+			if err := s.start(); err != nil {
+				s.log.Error("switch could not be started, it will be retried", "error", err)
+				s.updateSession(func(state *sessionState) { state.LastError = err.Error() })
+				go func() {
+					s.restart("initial start failed: " + err.Error())
+					if clusterMode == shardedMode && s.running() {
+						s.shard()
+					}
+				}()
+				return
+			}
+			if clusterMode == shardedMode {
+				s.shard()
+			}
+		}(s)
+	}
+	wg.Wait()
 
-	httpHandler(pbx, applicationName)
+	watchReload()
+	httpHandler()
 
-	cleanUpHook(sessionID, applicationName)
+	cleanUpHook()
 }
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/rresender/csta-integration/cti/provider"
+)
+
+func TestHTTPStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"invalid device", &provider.CSTAError{Category: provider.OperationCategory, Value: "invalidDeviceID"}, http.StatusNotFound},
+		{"no active call", &provider.CSTAError{Category: provider.StateIncompatibilityCategory, Value: "noActiveCall"}, http.StatusNotFound},
+		{"invalid call ID", &provider.CSTAError{Category: provider.OperationCategory, Value: "invalidCallID"}, http.StatusNotFound},
+		{"security", &provider.CSTAError{Category: provider.SecurityCategory, Value: "securityViolation"}, http.StatusForbidden},
+		{"not allowed", &provider.CSTAError{Category: provider.OperationCategory, Value: "requestIncompatibleWithDevice"}, http.StatusForbidden},
+		{"state incompatibility", &provider.CSTAError{Category: provider.StateIncompatibilityCategory, Value: "invalidObjectState"}, http.StatusConflict},
+		{"resource busy", &provider.CSTAError{Category: provider.OperationCategory, Value: "resourceBusy"}, http.StatusConflict},
+		{"system resource", &provider.CSTAError{Category: provider.SystemResourceAvailabilityCategory, Value: "generic"}, http.StatusServiceUnavailable},
+		{"wrapped", fmt.Errorf("hold: %w", &provider.CSTAError{Category: provider.OperationCategory, Value: "invalidCallID"}), http.StatusNotFound},
+		{"other operation", &provider.CSTAError{Category: provider.OperationCategory, Value: "generic"}, http.StatusBadRequest},
+		{"invalid request", invalidRequest(errors.New("callID is required")), http.StatusBadRequest},
+		{"wrapped invalid request", fmt.Errorf("make: %w", invalidRequest(errors.New("destination is required"))), http.StatusBadRequest},
+		{"response timeout", fmt.Errorf("%w for invokeID 1 from pbx1 after 5s", errResponseTimeout), http.StatusGatewayTimeout},
+		{"not connected", errNotConnected, http.StatusServiceUnavailable},
+		{"send failed", fmt.Errorf("%w: broken pipe", errNotConnected), http.StatusServiceUnavailable},
+		{"invalid session", &provider.SessionError{Service: "ResetApplicationSessionTimer", DefinedError: provider.InvalidSessionID}, http.StatusServiceUnavailable},
+		{"not monitored", errNotMonitored, http.StatusNotFound},
+		{"other error", errors.New("redis: connection refused"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := httpStatus(tt.err); got != tt.want {
+				t.Errorf("httpStatus(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// requestTimeout of the API requests, the events are streamed without a timeout
+const requestTimeout = 60 * time.Second
+
+type client struct {
+	url        string
+	switchName string
+	token      string
+	http       *http.Client
+	stream     *http.Client
+}
+
+func newClient(baseURL string, switchName string, token string) *client {
+	return &client{
+		url:        strings.TrimSuffix(baseURL, "/"),
+		switchName: switchName,
+		token:      token,
+		http:       &http.Client{Timeout: requestTimeout},
+		stream:     &http.Client{},
+	}
+}
+
+// APIError response of the API with an error status
+type APIError struct {
+	Status  int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s (%d)", e.Message, e.Status)
+}
+
+func (c *client) endpoint(path string, values url.Values) string {
+	if values == nil {
+		values = url.Values{}
+	}
+	if c.switchName != "" {
+		values.Set("switch", c.switchName)
+	}
+	if len(values) == 0 {
+		return c.url + path
+	}
+	return c.url + path + "?" + values.Encode()
+}
+
+func (c *client) do(method string, path string, values url.Values, body url.Values) (*http.Response, error) {
+	var reader io.Reader
+	contentType := ""
+	if body != nil {
+		reader = strings.NewReader(body.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	}
+	return c.send(method, path, values, reader, contentType)
+}
+
+func (c *client) send(method string, path string, values url.Values, body io.Reader, contentType string) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.endpoint(path, values), body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	httpClient := c.http
+	if strings.HasPrefix(path, "/events/") || strings.HasPrefix(path, "/console/events/") {
+		httpClient = c.stream
+	}
+	return httpClient.Do(req)
+}
+
+// text response of the API, the message of an error status is returned as an APIError
+func (c *client) text(method string, path string, body url.Values) (string, error) {
+	resp, err := c.do(method, path, nil, body)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	message := strings.TrimSpace(string(data))
+	if resp.StatusCode >= http.StatusBadRequest {
+		return "", &APIError{Status: resp.StatusCode, Message: message}
+	}
+	return message, nil
+}
+
+// decode the JSON response of the API, allowing the statuses in accepted besides 200
+func (c *client) decode(path string, v interface{}, accepted ...int) error {
+	resp, err := c.do(http.MethodGet, path, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	ok := resp.StatusCode == http.StatusOK
+	for _, status := range accepted {
+		ok = ok || resp.StatusCode == status
+	}
+	if !ok {
+		return readError(resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Monitor extension monitored by the service
+type Monitor struct {
+	ID                string
+	Type              string
+	Switch            string
+	Owner             string
+	DeviceID          string
+	MonitorCrossRefID string
+}
+
+// Health of an instance of the service, as reported by /healthz and /readyz
+type Health struct {
+	Status   string `json:"status"`
+	Instance string `json:"instance"`
+	Mode     string `json:"mode"`
+	Redis    struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+	} `json:"redis"`
+	RabbitMQ struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+	} `json:"rabbitmq"`
+	Switches []struct {
+		Name          string     `json:"name"`
+		Status        string     `json:"status"`
+		Provider      string     `json:"provider"`
+		Session       string     `json:"session"`
+		SessionID     string     `json:"sessionID"`
+		Duration      string     `json:"duration"`
+		LastHeartbeat *time.Time `json:"lastHeartbeat"`
+		LastError     string     `json:"lastError"`
+		Restarts      int        `json:"restarts"`
+		Monitors      []struct {
+			Extension string `json:"extension"`
+			Type      string `json:"type"`
+			Status    string `json:"status"`
+		} `json:"monitors"`
+	} `json:"switches"`
+}
+
+// Result of a command on an extension
+type Result struct {
+	Extension string `json:"extension"`
+	Type      string `json:"type,omitempty"`
+	Switch    string `json:"switch,omitempty"`
+	OK        bool   `json:"ok"`
+	Message   string `json:"message"`
+}
+
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func table() *tabwriter.Writer {
+	return tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+}
+
+func printResults(results []Result) error {
+	if output == "json" {
+		return printJSON(results)
+	}
+	w := table()
+	fmt.Fprintln(w, "EXTENSION\tTYPE\tSWITCH\tRESULT\tMESSAGE")
+	for _, r := range results {
+		result := "ok"
+		if !r.OK {
+			result = "failed"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Extension, r.Type, r.Switch, result, r.Message)
+	}
+	return w.Flush()
+}
+
+func listMonitors() error {
+	var monitors []Monitor
+	if err := api.decode("/monitors", &monitors); err != nil {
+		return err
+	}
+	if output == "json" {
+		return printJSON(monitors)
+	}
+	w := table()
+	fmt.Fprintln(w, "SWITCH\tEXTENSION\tTYPE\tDEVICE\tMONITOR\tOWNER")
+	for _, m := range monitors {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", m.Switch, m.ID, m.Type, m.DeviceID, m.MonitorCrossRefID, m.Owner)
+	}
+	return w.Flush()
+}
+
+func start(extType string, extension string) Result {
+	message, err := api.text(http.MethodGet, "/start/"+url.PathEscape(extType)+"/"+url.PathEscape(extension), nil)
+	if err != nil {
+		return Result{Extension: extension, Type: extType, Switch: api.switchName, Message: err.Error()}
+	}
+	return Result{Extension: extension, Type: extType, Switch: api.switchName, OK: true, Message: message}
+}
+
+func startMonitor(extType string, extension string) error {
+	result := start(extType, extension)
+	if err := printResults([]Result{result}); err != nil {
+		return err
+	}
+	if !result.OK {
+		os.Exit(1)
+	}
+	return nil
+}
+
+func stopMonitor(extension string) error {
+	result := Result{Extension: extension, Switch: api.switchName, OK: true}
+	message, err := api.text(http.MethodGet, "/stop/"+url.PathEscape(extension), nil)
+	if err != nil {
+		result.OK, message = false, err.Error()
+	}
+	result.Message = message
+	if err := printResults([]Result{result}); err != nil {
+		return err
+	}
+	if !result.OK {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// importMonitors starts the monitors of the rows extension,type[,switch], a header row and # comments are skipped
+func importMonitors(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	reader := csv.NewReader(bufio.NewReader(f))
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	defaultSwitch := api.switchName
+	var results []Result
+	failed := false
+	for line := 1; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if line == 1 && strings.EqualFold(strings.TrimSpace(row[0]), "extension") {
+			continue
+		}
+		if len(row) < 2 || len(row) > 3 {
+			return fmt.Errorf("%s: line %d must be extension,type[,switch]", file, line)
+		}
+		api.switchName = defaultSwitch
+		if len(row) == 3 && strings.TrimSpace(row[2]) != "" {
+			api.switchName = strings.TrimSpace(row[2])
+		}
+		result := start(strings.ToUpper(strings.TrimSpace(row[1])), strings.TrimSpace(row[0]))
+		failed = failed || !result.OK
+		results = append(results, result)
+	}
+	api.switchName = defaultSwitch
+	if err := printResults(results); err != nil {
+		return err
+	}
+	if failed {
+		os.Exit(1)
+	}
+	return nil
+}
+
+func showHealth(path string) error {
+	var health Health
+	if err := api.decode(path, &health, http.StatusServiceUnavailable); err != nil {
+		return err
+	}
+	if output == "json" {
+		return printJSON(health)
+	}
+	w := table()
+	fmt.Fprintf(w, "Instance %s (mode: %s): %s\n", health.Instance, health.Mode, health.Status)
+	fmt.Fprintf(w, "redis: %s %s\n", health.Redis.Status, health.Redis.Error)
+	fmt.Fprintf(w, "rabbitmq: %s %s\n", health.RabbitMQ.Status, health.RabbitMQ.Error)
+	if len(health.Switches) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "SWITCH\tSTATUS\tPROVIDER\tSESSION\tSESSION ID\tDURATION\tLAST HEARTBEAT\tRESTARTS\tMONITORS\tLAST ERROR")
+		for _, s := range health.Switches {
+			heartbeat := ""
+			if s.LastHeartbeat != nil && !s.LastHeartbeat.IsZero() {
+				heartbeat = s.LastHeartbeat.Format(time.RFC3339)
+			}
+			up := 0
+			for _, m := range s.Monitors {
+				if m.Status == "up" {
+					up++
+				}
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%d/%d\t%s\n", s.Name, s.Status, s.Provider, s.Session, s.SessionID,
+				s.Duration, heartbeat, s.Restarts, up, len(s.Monitors), s.LastError)
+		}
+	}
+	return w.Flush()
+}
+
+// tailEvents prints the events of the extension until interrupted
+func tailEvents(extension string) error {
+	resp, err := api.do(http.MethodGet, "/events/"+url.PathEscape(extension), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return readError(resp)
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if output == "json" {
+			fmt.Println(string(line))
+			continue
+		}
+		var event map[string]json.RawMessage
+		if err := json.Unmarshal(line, &event); err != nil || len(event) != 1 {
+			fmt.Printf("%s %s\n", time.Now().Format("15:04:05.000"), line)
+			continue
+		}
+		for name, body := range event {
+			fmt.Printf("%s %-24s %s\n", time.Now().Format("15:04:05.000"), name, body)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("the event stream has been closed by the service")
+}
+
+func callControl(args []string) error {
+	flags := flag.NewFlagSet("call", flag.ExitOnError)
+	callID := flags.String("call-id", "", "call of the command, required except to make a call")
+	destination := flags.String("destination", "", "number to call or to transfer the call to")
+	uui := flags.String("uui", "", "user to user information of the call made or transferred")
+	uuiFormat := flags.String("uui-format", "", "format of the user to user information: plain (default), hex or shared")
+	if len(args) < 2 {
+		return errors.New("usage: ctictl call <answer|clear|hold|retrieve|make|transfer> <extension> [-call-id ID] [-destination number] [-uui text] [-uui-format plain|hex|shared]")
+	}
+	action, extension := args[0], args[1]
+	flags.Parse(args[2:])
+
+	body := url.Values{}
+	body.Set("callID", *callID)
+	body.Set("destination", *destination)
+	body.Set("uui", *uui)
+	body.Set("uuiFormat", *uuiFormat)
+	result := Result{Extension: extension, Switch: api.switchName, OK: true}
+	message, err := api.text(http.MethodPost, "/calls/"+url.PathEscape(extension)+"/"+url.PathEscape(action), body)
+	if err != nil {
+		result.OK, message = false, err.Error()
+	}
+	result.Message = message
+	if err := printResults([]Result{result}); err != nil {
+		return err
+	}
+	if !result.OK {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// AuditEntry action recorded in the audit log of the service
+type AuditEntry struct {
+	ID        string            `json:"id"`
+	Time      time.Time         `json:"time"`
+	Instance  string            `json:"instance"`
+	Actor     string            `json:"actor"`
+	Method    string            `json:"method"`
+	Remote    string            `json:"remote,omitempty"`
+	Forwarded string            `json:"forwardedFor,omitempty"`
+	Action    string            `json:"action"`
+	Switch    string            `json:"switch,omitempty"`
+	Extension string            `json:"extension,omitempty"`
+	Params    map[string]string `json:"params,omitempty"`
+	Result    string            `json:"result"`
+	Error     string            `json:"error,omitempty"`
+	CSTAError string            `json:"cstaError,omitempty"`
+}
+
+// listAudit prints the audit entries of the filters or, with -export, copies their export to stdout
+func listAudit(args []string) error {
+	flags := flag.NewFlagSet("audit", flag.ExitOnError)
+	from := flags.String("from", "", "entries since a time: RFC3339, unix seconds or a duration ago like 24h")
+	to := flags.String("to", "", "entries until a time: RFC3339, unix seconds or a duration ago")
+	actor := flags.String("actor", "", "name of the API key or subject of the token")
+	action := flags.String("action", "", "action or group of actions, like monitor or call.make")
+	extension := flags.String("extension", "", "extension of the action")
+	result := flags.String("result", "", "ok or error")
+	limit := flags.Int("limit", 0, "maximum number of entries, 100 by default")
+	export := flags.String("export", "", "export every entry of the filters as csv or ndjson")
+	flags.Parse(args)
+
+	values := url.Values{}
+	for key, value := range map[string]string{"from": *from, "to": *to, "actor": *actor, "action": *action,
+		"extension": *extension, "result": *result} {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+	if *limit > 0 {
+		values.Set("limit", fmt.Sprint(*limit))
+	}
+
+	path := "/audit"
+	if *export != "" {
+		path = "/audit/export"
+		values.Set("format", *export)
+	}
+	resp, err := api.do(http.MethodGet, path, values, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return readError(resp)
+	}
+	if *export != "" {
+		_, err := io.Copy(os.Stdout, resp.Body)
+		return err
+	}
+
+	var entries []AuditEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return err
+	}
+	if output == "json" {
+		return printJSON(entries)
+	}
+	w := table()
+	fmt.Fprintln(w, "TIME\tACTOR\tACTION\tSWITCH\tEXTENSION\tPARAMS\tRESULT\tERROR")
+	for _, e := range entries {
+		params := make([]string, 0, len(e.Params))
+		for k, v := range e.Params {
+			params = append(params, k+"="+v)
+		}
+		sort.Strings(params)
+		message := e.Error
+		if e.CSTAError != "" {
+			message = e.CSTAError + ": " + message
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.Time.Local().Format(time.RFC3339), e.Actor, e.Action, e.Switch,
+			e.Extension, strings.Join(params, " "), e.Result, message)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// ConsoleResult correlated response of a raw CSTA request
+type ConsoleResult struct {
+	Switch   string        `json:"switch"`
+	InvokeID string        `json:"invokeID"`
+	Request  string        `json:"request"`
+	Response string        `json:"response"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// ConsoleEvent raw unsolicited event of a watched monitor
+type ConsoleEvent struct {
+	Time              time.Time `json:"time"`
+	Name              string    `json:"name"`
+	MonitorCrossRefID string    `json:"monitorCrossRefID"`
+	Data              string    `json:"data"`
+}
+
+func readError(resp *http.Response) error {
+	data, _ := io.ReadAll(resp.Body)
+	return &APIError{Status: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+}
+
+// consoleRequest sends the XML request of the file, or of stdin, and prints the correlated response
+func consoleRequest(args []string) error {
+	in := io.Reader(os.Stdin)
+	if len(args) == 1 && args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	message, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	resp, err := api.send(http.MethodPost, "/console", nil, strings.NewReader(string(message)), "application/xml")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return readError(resp)
+	}
+	var result ConsoleResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if output == "json" {
+		return printJSON(result)
+	}
+	fmt.Printf("switch: %s, invokeID: %s, duration: %v\n", result.Switch, result.InvokeID, result.Duration)
+	if result.Error != "" {
+		fmt.Printf("error: %s\n", result.Error)
+	}
+	fmt.Println(result.Response)
+	if result.Error != "" {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// watchEvents prints the raw unsolicited events of the monitor until interrupted
+func watchEvents(monitorCrossRefID string) error {
+	resp, err := api.do(http.MethodGet, "/console/events/"+url.PathEscape(monitorCrossRefID), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return readError(resp)
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if output == "json" {
+			fmt.Println(scanner.Text())
+			continue
+		}
+		var event ConsoleEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return err
+		}
+		fmt.Printf("%s %s\n%s\n\n", event.Time.Format("15:04:05.000"), event.Name, event.Data)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("the event stream has been closed by the service")
+}
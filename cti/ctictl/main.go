@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const usage = `ctictl operates the CTI monitoring service through its API
+
+Usage:
+  ctictl [flags] <command> [arguments]
+
+Commands:
+  monitors                          list the monitored extensions
+  start <VDN|SKILL> <extension>     start monitoring an extension
+  stop <extension>                  stop monitoring an extension
+  import <file.csv>                 start the monitors of a CSV file of extension,type[,switch] rows
+  status                            show the sessions, the monitors and the dependencies (readiness)
+  health                            show the connections to redis and RabbitMQ (liveness)
+  events <extension>                tail the live events of an extension
+  call <action> <extension>         answer, clear, hold, retrieve, make or transfer a call
+        -call-id <ID> -destination <number> -uui <text> -uui-format <plain|hex|shared>
+  console [file.xml]                send a raw CSTA request, read from stdin without a file, and print its response
+  watch <monitorCrossRefID>         tail the raw unsolicited events of a monitor
+  audit                             list the audit entries, newest first
+        -from <time> -to <time> -actor <name> -action <action> -extension <extension> -result <ok|error>
+        -limit <n> -export <csv|ndjson>
+
+Flags:
+`
+
+// client of the monitoring service API
+var api *client
+
+// output format, table or json
+var output string
+
+func main() {
+	flags := flag.NewFlagSet("ctictl", flag.ExitOnError)
+	url := flags.String("url", env("CTI_URL", "http://localhost:7700"), "URL of the monitoring service API (CTI_URL)")
+	switchName := flags.String("switch", "", "switch of the command, the first configured switch by default")
+	token := flags.String("token", os.Getenv("CTI_TOKEN"), "bearer token of the API (CTI_TOKEN)")
+	flags.StringVar(&output, "o", "table", "output format: table or json")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flags.PrintDefaults()
+	}
+	flags.Parse(os.Args[1:])
+
+	if output != "table" && output != "json" {
+		fail(fmt.Errorf("output %s is not valid, use table or json", output))
+	}
+	args := flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	api = newClient(*url, *switchName, *token)
+
+	var err error
+	switch command, args := args[0], args[1:]; command {
+	case "monitors":
+		err = listMonitors()
+	case "start":
+		if len(args) != 2 {
+			fail(fmt.Errorf("usage: ctictl start <VDN|SKILL> <extension>"))
+		}
+		err = startMonitor(strings.ToUpper(args[0]), args[1])
+	case "stop":
+		if len(args) != 1 {
+			fail(fmt.Errorf("usage: ctictl stop <extension>"))
+		}
+		err = stopMonitor(args[0])
+	case "import":
+		if len(args) != 1 {
+			fail(fmt.Errorf("usage: ctictl import <file.csv>"))
+		}
+		err = importMonitors(args[0])
+	case "status":
+		err = showHealth("/readyz")
+	case "health":
+		err = showHealth("/healthz")
+	case "events":
+		if len(args) != 1 {
+			fail(fmt.Errorf("usage: ctictl events <extension>"))
+		}
+		err = tailEvents(args[0])
+	case "call":
+		err = callControl(args)
+	case "console":
+		if len(args) > 1 {
+			fail(fmt.Errorf("usage: ctictl console [file.xml]"))
+		}
+		err = consoleRequest(args)
+	case "watch":
+		if len(args) != 1 {
+			fail(fmt.Errorf("usage: ctictl watch <monitorCrossRefID>"))
+		}
+		err = watchEvents(args[0])
+	case "audit":
+		err = listAudit(args)
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fail(err)
+	}
+}
+
+func env(key string, value string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return value
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "ctictl:", err)
+	os.Exit(1)
+}
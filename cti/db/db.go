@@ -2,14 +2,17 @@ package db
 
 import (
 	"encoding/json"
-	"log"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/rresender/csta-integration/cti/helper"
+	"github.com/rresender/csta-integration/cti/logger"
 	"github.com/rresender/csta-integration/cti/redis"
 )
 
+var log = logger.New("db")
+
 // MaxInvokeID allowed
 var MaxInvokeID = 9999
 
@@ -17,6 +20,8 @@ var MaxInvokeID = 9999
 type Extension struct {
 	ID                string
 	Type              string
+	Switch            string
+	Owner             string
 	DeviceID          string
 	MonitorCrossRefID string
 }
@@ -77,30 +82,40 @@ func GetInvokeNoTTL(queueID string, appName string) string {
 	return invokeID
 }
 
-// GetAllExtensions being managed
-func GetAllExtensions() []string {
-	return redis.GetValues("extensions")
+// GetAllExtensions being managed on a switch
+func GetAllExtensions(switchName string) []string {
+	return redis.GetValues(helper.GetExtensionsKey(switchName))
 }
 
 // AddExtensionToList to the memory
-func AddExtensionToList(extension string) {
-	redis.PushValue("extensions", extension)
+func AddExtensionToList(switchName string, extension string) {
+	redis.PushValue(helper.GetExtensionsKey(switchName), extension)
 }
 
 // RemoveExtensionFromList from the memory
-func RemoveExtensionFromList(extension string) {
-	redis.RemoveValue("extensions", extension)
+func RemoveExtensionFromList(switchName string, extension string) {
+	redis.RemoveValue(helper.GetExtensionsKey(switchName), extension)
+}
+
+// ExtensionExists on a switch
+func ExtensionExists(switchName string, ID string) bool {
+	return Exists(helper.GetExtensionKey(switchName, ID))
+}
+
+// DeleteExtension Object
+func DeleteExtension(switchName string, ID string) {
+	Delete(helper.GetExtensionKey(switchName, ID))
 }
 
 //FindExtension Object
-func FindExtension(ID string) *Extension {
-	v, _ := redis.Get(ID)
+func FindExtension(switchName string, ID string) *Extension {
+	v, _ := redis.Get(helper.GetExtensionKey(switchName, ID))
 	if v == nil {
 		return nil
 	}
 	var extension Extension
 	if err := json.Unmarshal(v, &extension); err != nil {
-		log.Printf("error while marshaling json %v\n", err)
+		log.Error("FindExtension failed", "switch", switchName, "extension", ID, "error", err)
 		return nil
 	}
 	return &extension
@@ -110,7 +125,100 @@ func FindExtension(ID string) *Extension {
 func SaveExtension(extension *Extension) {
 	value, err := json.Marshal(&extension)
 	if err != nil {
-		log.Printf("error while marshaling json %v\n", err)
+		log.Error("SaveExtension failed", "switch", extension.Switch, "extension", extension.ID, "error", err)
+	}
+	redis.Set(helper.GetExtensionKey(extension.Switch, extension.ID), value)
+}
+
+// AcquireLeadership of a switch for the instance
+func AcquireLeadership(switchName string, instance string, ttl time.Duration) bool {
+	ok, err := redis.AcquireLock(helper.GetLeaderKey(switchName), instance, ttl)
+	if err != nil {
+		log.Error("AcquireLeadership failed", "switch", switchName, "error", err)
 	}
-	redis.Set(extension.ID, value)
+	return ok
+}
+
+// RenewLeadership of a switch while it is held by the instance
+func RenewLeadership(switchName string, instance string, ttl time.Duration) bool {
+	ok, err := redis.RenewLock(helper.GetLeaderKey(switchName), instance, ttl)
+	if err != nil {
+		log.Error("RenewLeadership failed", "switch", switchName, "error", err)
+	}
+	return ok
+}
+
+// ReleaseLeadership of a switch held by the instance
+func ReleaseLeadership(switchName string, instance string) {
+	if err := redis.ReleaseLock(helper.GetLeaderKey(switchName), instance); err != nil {
+		log.Error("ReleaseLeadership failed", "switch", switchName, "error", err)
+	}
+}
+
+// GetLeader instance of a switch
+func GetLeader(switchName string) string {
+	return redis.GetString(helper.GetLeaderKey(switchName))
+}
+
+// JoinCluster of a switch, refreshing the membership of the instance
+func JoinCluster(switchName string, instance string) {
+	if err := redis.AddScored(helper.GetMembersKey(switchName), instance, time.Now().UnixNano()); err != nil {
+		log.Error("JoinCluster failed", "switch", switchName, "error", err)
+	}
+}
+
+// LeaveCluster of a switch
+func LeaveCluster(switchName string, instance string) {
+	if err := redis.RemoveScored(helper.GetMembersKey(switchName), instance); err != nil {
+		log.Error("LeaveCluster failed", "switch", switchName, "error", err)
+	}
+}
+
+// GetMembers of the cluster of a switch refreshed within the ttl
+func GetMembers(switchName string, ttl time.Duration) []string {
+	members, err := redis.GetScoredFrom(helper.GetMembersKey(switchName), time.Now().Add(-ttl).UnixNano())
+	if err != nil {
+		log.Error("GetMembers failed", "switch", switchName, "error", err)
+	}
+	return members
+}
+
+// AddDesiredExtension to be monitored by the cluster of a switch
+func AddDesiredExtension(switchName string, ID string, extType string) {
+	if err := redis.SetField(helper.GetDesiredExtensionsKey(switchName), ID, extType); err != nil {
+		log.Error("AddDesiredExtension failed", "switch", switchName, "error", err)
+	}
+}
+
+// AddDesiredExtensionIfMissing keeping the type of an existing extension
+func AddDesiredExtensionIfMissing(switchName string, ID string, extType string) {
+	if err := redis.SetFieldNX(helper.GetDesiredExtensionsKey(switchName), ID, extType); err != nil {
+		log.Error("AddDesiredExtensionIfMissing failed", "switch", switchName, "error", err)
+	}
+}
+
+// RemoveDesiredExtension from the cluster of a switch
+func RemoveDesiredExtension(switchName string, ID string) {
+	if err := redis.DeleteField(helper.GetDesiredExtensionsKey(switchName), ID); err != nil {
+		log.Error("RemoveDesiredExtension failed", "switch", switchName, "error", err)
+	}
+}
+
+// GetDesiredExtensions of the cluster of a switch by ID with their types
+func GetDesiredExtensions(switchName string) map[string]string {
+	extensions, err := redis.GetFields(helper.GetDesiredExtensionsKey(switchName))
+	if err != nil {
+		log.Error("GetDesiredExtensions failed", "switch", switchName, "error", err)
+	}
+	return extensions
+}
+
+// AppendAudit entry to the append-only audit stream
+func AppendAudit(entry string) (string, error) {
+	return redis.AppendStream(helper.GetAuditKey(), "entry", entry)
+}
+
+// ReadAudit entries between the stream IDs, newest first when reverse
+func ReadAudit(start string, end string, count int, reverse bool) ([]redis.StreamEntry, error) {
+	return redis.RangeStream(helper.GetAuditKey(), "entry", start, end, count, reverse)
 }
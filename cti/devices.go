@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/rresender/csta-integration/cti/provider"
+)
+
+// forwardingTypes supported by SetForwarding
+var forwardingTypes = map[string]bool{
+	"forwardImmediate": true,
+	"forwardBusy":      true,
+	"forwardNoAns":     true,
+	"forwardBusyInt":   true,
+	"forwardBusyExt":   true,
+	"forwardNoAnsInt":  true,
+	"forwardNoAnsExt":  true,
+	"forwardImmInt":    true,
+	"forwardImmExt":    true,
+	"forwardDND":       true,
+	"forwardDNDInt":    true,
+	"forwardDNDExt":    true,
+}
+
+// DeviceState logical and physical features of a station, a feature that could not be queried keeps its error
+type DeviceState struct {
+	Extension         string
+	DeviceID          string
+	Info              *provider.QueryDeviceInfoResponse
+	InfoErr           error
+	DoNotDisturb      bool
+	DoNotDisturbErr   error
+	Forwarding        []provider.ForwardListItem
+	ForwardingErr     error
+	MessageWaiting    bool
+	MessageWaitingErr error
+}
+
+func (s *Switch) getDeviceState(extension string) (*DeviceState, error) {
+	deviceID, err := s.getDeviceID(extension)
+	if err != nil {
+		return nil, err
+	}
+	state := &DeviceState{Extension: extension, DeviceID: deviceID}
+
+	var info provider.QueryDeviceInfoResponse
+	if state.InfoErr = s.request(extension, provider.QueryDeviceInfoMessage(deviceID), &info); state.InfoErr == nil {
+		state.Info = &info
+	}
+
+	var dnd provider.GetDoNotDisturbResponse
+	state.DoNotDisturbErr = s.request(extension, provider.GetDoNotDisturbMessage(deviceID), &dnd)
+	state.DoNotDisturb = dnd.DoNotDisturbOn
+
+	var forwarding provider.GetForwardingResponse
+	state.ForwardingErr = s.request(extension, provider.GetForwardingMessage(deviceID), &forwarding)
+	state.Forwarding = forwarding.ForwardingList
+
+	var mwi provider.GetMessageWaitingIndicatorResponse
+	state.MessageWaitingErr = s.request(extension, provider.GetMessageWaitingIndicatorMessage(deviceID), &mwi)
+	state.MessageWaiting = mwi.MessageWaitingOn
+
+	return state, nil
+}
+
+func (s *Switch) setDoNotDisturb(extension string, on bool) error {
+	deviceID, err := s.getDeviceID(extension)
+	if err != nil {
+		return err
+	}
+	var response provider.SetDoNotDisturbResponse
+	return s.request(extension, provider.SetDoNotDisturbMessage(deviceID, on), &response)
+}
+
+// validateForwarding of the API before it is sent to the provider, the destination is only required to activate it
+func validateForwarding(forwardingType string, on bool, destination string) error {
+	if !forwardingTypes[forwardingType] {
+		return invalidRequest(fmt.Errorf("forwarding type %q is not valid", forwardingType))
+	}
+	if !on {
+		return nil
+	}
+	if destination == "" {
+		return invalidRequest(fmt.Errorf("a destination is required to activate %s", forwardingType))
+	}
+	return validateDestination(destination)
+}
+
+func (s *Switch) setForwarding(extension string, forwardingType string, on bool, destination string) error {
+	if err := validateForwarding(forwardingType, on, destination); err != nil {
+		return err
+	}
+	deviceID, err := s.getDeviceID(extension)
+	if err != nil {
+		return err
+	}
+	var response provider.SetForwardingResponse
+	return s.request(extension, provider.SetForwardingMessage(deviceID, forwardingType, on, destination), &response)
+}
+
+func (s *Switch) setMessageWaitingIndicator(extension string, on bool) error {
+	deviceID, err := s.getDeviceID(extension)
+	if err != nil {
+		return err
+	}
+	var response provider.SetMessageWaitingIndicatorResponse
+	return s.request(extension, provider.SetMessageWaitingIndicatorMessage(deviceID, on), &response)
+}
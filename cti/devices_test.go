@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rresender/csta-integration/cti/provider"
+)
+
+func TestValidateForwarding(t *testing.T) {
+	tests := []struct {
+		name           string
+		forwardingType string
+		on             bool
+		destination    string
+		wantErr        string
+	}{
+		{"activate", "forwardImmediate", true, "+5511999", ""},
+		{"deactivate without destination", "forwardBusy", false, "", ""},
+		{"unknown type", "forwardAll", true, "2000", `forwarding type "forwardAll" is not valid`},
+		{"injected type", "forwardBusy</forwardingType>", false, "", "is not valid"},
+		{"activate without destination", "forwardNoAns", true, "", "a destination is required"},
+		{"injected destination", "forwardImmediate", true, "2000</forwardDN><x>", "must contain only digits"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateForwarding(tt.forwardingType, tt.on, tt.destination)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateForwarding() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateForwarding() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSetForwardingMessageEscaped(t *testing.T) {
+	message := provider.SetForwardingMessage("1000:pbx::0", "forwardImmediate", true, "2000<x>")
+	if want := "<forwardDN>2000&lt;x&gt;</forwardDN>"; !strings.Contains(message, want) {
+		t.Errorf("SetForwardingMessage() = %s, want %s", message, want)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+
+	"github.com/rresender/csta-integration/cti/db"
+	"github.com/rresender/csta-integration/cti/helper"
+	"github.com/rresender/csta-integration/cti/provider"
+	"github.com/rresender/csta-integration/cti/rabbitmq"
+)
+
+// validateDigits of a GenerateDigits request of the API
+func validateDigits(callID string, digits string) error {
+	if err := validateCallID(callID); err != nil {
+		return err
+	}
+	if !provider.ValidDigits(digits) {
+		return invalidRequest(errors.New("digits must contain only 0-9, A-D, * and #"))
+	}
+	return nil
+}
+
+// generateDigits sends DTMF digits on the call of the extension
+func (s *Switch) generateDigits(extension string, callID string, digits string) error {
+	if err := validateDigits(callID, digits); err != nil {
+		return err
+	}
+	deviceID, err := s.getDeviceID(extension)
+	if err != nil {
+		return err
+	}
+	var response provider.GenerateDigitsResponse
+	return s.request(extension, provider.GenerateDigitsMessage(callID, deviceID, digits), &response)
+}
+
+// publishDigitsEvent publishes a DigitsGenerated or EnteredDigits event, masking its digits when the redaction is enabled
+func (s *Switch) publishDigitsEvent(name string, data string) {
+	var event interface{}
+	var monitorCrossRefID string
+	switch name {
+	case "DigitsGeneratedEvent":
+		var e provider.DigitsGeneratedEvent
+		if err := provider.ParseMessageResponse(data, &e); err != nil {
+			return
+		}
+		if provider.DigitsRedaction() {
+			e.DigitsGeneratedList = provider.MaskDigits(e.DigitsGeneratedList)
+		}
+		event, monitorCrossRefID = e, e.MonitorCrossRefID
+	case "EnteredDigitsEvent":
+		var e provider.EnteredDigitsEvent
+		if err := provider.ParseMessageResponse(data, &e); err != nil {
+			return
+		}
+		if provider.DigitsRedaction() {
+			e.Digits = provider.MaskDigits(e.Digits)
+		}
+		event, monitorCrossRefID = e, e.MonitorCrossRefID
+	}
+	converted, err := json.Marshal(map[string]interface{}{name: event})
+	if err != nil {
+		s.log.Error("digits event could not be converted", "type", name, "monitorCrossRefID", monitorCrossRefID, "error", err)
+		return
+	}
+	queue := db.Find(helper.GetMonitorCrossRefIDKey(monitorCrossRefID, s.appName))
+	if queue == "" {
+		s.log.Warn("digits event of an unknown monitor has been dropped", "event", name, "monitorCrossRefID", monitorCrossRefID)
+		return
+	}
+	rabbitmq.Send(helper.GetExchangeName(s.Name, queue), bytes.NewBuffer(converted))
+}
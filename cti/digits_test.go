@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rresender/csta-integration/cti/provider"
+)
+
+func TestValidateDigits(t *testing.T) {
+	tests := []struct {
+		name    string
+		callID  string
+		digits  string
+		wantErr string
+	}{
+		{"digits", "42", "0123456789ABCD*#", ""},
+		{"missing call", "", "1", "callID is required"},
+		{"injected call", "42</callID>", "1", `callID "42</callID>" is not valid`},
+		{"no digits", "42", "", "digits must contain only"},
+		{"injected digits", "42", "1</charactersToSend><x>", "digits must contain only"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDigits(tt.callID, tt.digits)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateDigits() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateDigits() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGenerateDigitsMessageEscaped(t *testing.T) {
+	message := provider.GenerateDigitsMessage("42<x>", "1000:pbx::0", "1&2")
+	for _, want := range []string{"<callID>42&lt;x&gt;</callID>", "<charactersToSend>1&amp;2</charactersToSend>"} {
+		if !strings.Contains(message, want) {
+			t.Errorf("GenerateDigitsMessage() = %s, want %s", message, want)
+		}
+	}
+}
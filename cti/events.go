@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/rresender/csta-integration/cti/rabbitmq"
+)
+
+// streamEvents writes the events published for the exchange as newline delimited JSON until the client goes away
+func streamEvents(w http.ResponseWriter, r *http.Request, exchange string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	messages, ch, err := rabbitmq.Subscribe(exchange)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer ch.Close()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case m, ok := <-messages:
+			if !ok {
+				return
+			}
+			w.Write(m.Body)
+			w.Write([]byte("\n"))
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/rresender/csta-integration/cti/rabbitmq"
+	"github.com/rresender/csta-integration/cti/redis"
+)
+
+const (
+	statusUp      = "up"
+	statusDown    = "down"
+	statusStandby = "standby"
+)
+
+// DependencyHealth of a connection used by the service
+type DependencyHealth struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// MonitorHealth of an extension handled by the instance
+type MonitorHealth struct {
+	Extension         string `json:"extension"`
+	Type              string `json:"type"`
+	Status            string `json:"status"`
+	MonitorCrossRefID string `json:"monitorCrossRefID,omitempty"`
+}
+
+// SwitchHealth of the provider link, the session and the monitors of a switch
+type SwitchHealth struct {
+	Name          string          `json:"name"`
+	Status        string          `json:"status"`
+	Provider      string          `json:"provider"`
+	Session       string          `json:"session"`
+	SessionID     string          `json:"sessionID,omitempty"`
+	Duration      string          `json:"duration,omitempty"`
+	LastHeartbeat *time.Time      `json:"lastHeartbeat,omitempty"`
+	LastError     string          `json:"lastError,omitempty"`
+	Restarts      int             `json:"restarts"`
+	Monitors      []MonitorHealth `json:"monitors"`
+}
+
+// Health of the instance
+type Health struct {
+	Status   string           `json:"status"`
+	Instance string           `json:"instance"`
+	Mode     string           `json:"mode"`
+	Redis    DependencyHealth `json:"redis"`
+	RabbitMQ DependencyHealth `json:"rabbitmq"`
+	Switches []SwitchHealth   `json:"switches,omitempty"`
+}
+
+func dependencyHealth(err error) DependencyHealth {
+	if err != nil {
+		return DependencyHealth{Status: statusDown, Error: err.Error()}
+	}
+	return DependencyHealth{Status: statusUp}
+}
+
+// expected to be active on this instance, a standby instance of the ha mode is not
+func (s *Switch) expected() bool {
+	return clusterMode != haMode || s.isLeading()
+}
+
+func (s *Switch) health() SwitchHealth {
+	s.lock.Lock()
+	conn, active, sessionID := s.conn, s.active, s.sessionID
+	s.lock.Unlock()
+	session := s.getSession()
+
+	h := SwitchHealth{Name: s.Name, Status: statusUp, Provider: statusDown, Session: statusDown, LastError: session.LastError, Restarts: session.Restarts}
+	if !s.expected() {
+		h.Status, h.Provider, h.Session = statusStandby, statusStandby, statusStandby
+	}
+	if conn != nil && !conn.Closed() {
+		h.Provider = statusUp
+	}
+	if active && sessionID != "" {
+		h.SessionID = sessionID
+		h.Duration = session.Duration.String()
+		h.LastHeartbeat = &session.LastHeartbeat
+		h.Session = statusUp
+		if time.Since(session.LastHeartbeat) > session.Duration {
+			h.Session = "expired"
+		}
+	}
+	if h.Status != statusStandby && (h.Provider != statusUp || h.Session != statusUp) {
+		h.Status = statusDown
+	}
+
+	h.Monitors = []MonitorHealth{}
+	for _, ext := range s.getExtensions() {
+		m := MonitorHealth{Extension: ext.ID, Type: ext.Type, Status: "pending", MonitorCrossRefID: ext.MonitorCrossRefID}
+		if ext.MonitorCrossRefID != "" {
+			m.Status = statusUp
+			if h.Session != statusUp {
+				m.Status = statusDown
+			}
+		}
+		h.Monitors = append(h.Monitors, m)
+	}
+	sort.Slice(h.Monitors, func(i, j int) bool {
+		return h.Monitors[i].Extension < h.Monitors[j].Extension
+	})
+	return h
+}
+
+// liveness fails when the connections to redis or RabbitMQ are lost, the sessions recover by themselves
+func liveness() (*Health, bool) {
+	health := &Health{
+		Status:   statusUp,
+		Instance: instanceID,
+		Mode:     clusterMode,
+		Redis:    dependencyHealth(redis.Check()),
+		RabbitMQ: dependencyHealth(rabbitmq.Check()),
+	}
+	if health.Redis.Status != statusUp || health.RabbitMQ.Status != statusUp {
+		health.Status = statusDown
+	}
+	return health, health.Status == statusUp
+}
+
+// readiness requires a live instance with every expected switch, and at least one, connected and heartbeating
+func readiness() (*Health, bool) {
+	health, live := liveness()
+	ready := live
+	active := 0
+	for _, s := range switches {
+		h := s.health()
+		switch h.Status {
+		case statusUp:
+			active++
+		case statusDown:
+			ready = false
+		}
+		health.Switches = append(health.Switches, h)
+	}
+	if active == 0 {
+		ready = false
+	}
+	if !ready && health.Status == statusUp {
+		health.Status = "unavailable"
+		if active == 0 && clusterMode == haMode {
+			health.Status = statusStandby
+		}
+	}
+	return health, ready
+}
+
+func writeHealth(w http.ResponseWriter, health *Health, ok bool) {
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(health)
+}
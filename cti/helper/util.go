@@ -32,6 +32,35 @@ func GetInvokeIDKey(invokeID string, appName string) string {
 	return appName + "invokeID" + invokeID
 }
 
+func GetExtensionKey(switchName string, extension string) string {
+	return switchName + "-extension-" + extension
+}
+
+func GetExtensionsKey(switchName string) string {
+	return switchName + "-extensions"
+}
+
+func GetLeaderKey(switchName string) string {
+	return switchName + "-leader"
+}
+
+func GetMembersKey(switchName string) string {
+	return switchName + "-members"
+}
+
+func GetDesiredExtensionsKey(switchName string) string {
+	return switchName + "-desired-extensions"
+}
+
+// GetExchangeName of the events of an extension, the same extension may exist on several switches
+func GetExchangeName(switchName string, extension string) string {
+	return switchName + "." + extension
+}
+
+func GetAuditKey() string {
+	return "cti-audit"
+}
+
 func GetLocalIP() string {
 	addrs, err := net.InterfaceAddrs()
 	if err != nil {
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rresender/csta-integration/cti/db"
+)
+
+const (
+	// leaseTTL time a leader keeps the switch without renewing it
+	leaseTTL = 6 * time.Second
+	// leaseRenewal interval of the leader renewal and the standby attempts
+	leaseRenewal = 2 * time.Second
+)
+
+// instanceID identifies the instance in the leader election
+var instanceID = func() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}()
+
+func (s *Switch) isLeading() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.leading
+}
+
+func (s *Switch) setLeading(leading bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.leading = leading
+}
+
+// elect keeps the switch started only while this instance holds its leadership
+func (s *Switch) elect() {
+	s.log.Info("standing by for the leadership", "instance", instanceID)
+	go func() {
+		ticker := time.NewTicker(leaseRenewal)
+		defer ticker.Stop()
+		for {
+			s.electionRound()
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (s *Switch) electionRound() {
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+	if s.isLeading() {
+		if db.RenewLeadership(s.Name, instanceID, leaseTTL) {
+			return
+		}
+		s.log.Warn("leadership has been lost, standing by", "instance", instanceID)
+		s.setLeading(false)
+		go s.shutdown()
+		return
+	}
+
+	if !db.AcquireLeadership(s.Name, instanceID, leaseTTL) {
+		return
+	}
+	s.log.Info("leadership acquired, taking over", "instance", instanceID)
+	s.setLeading(true)
+	go s.takeOver()
+}
+
+// takeOver starts a new session restoring the monitors of the previous leader,
+// unless the service is stopping or the leadership has been lost meanwhile
+func (s *Switch) takeOver() {
+	if !s.running() {
+		s.setLeading(false)
+		db.ReleaseLeadership(s.Name, instanceID)
+		return
+	}
+	if err := s.start(); err != nil {
+		s.log.Error("switch could not be started", "error", err)
+		s.setLeading(false)
+		s.shutdown()
+		db.ReleaseLeadership(s.Name, instanceID)
+	}
+}
+
+// resign the leadership handing the switch over to a standby instance
+func (s *Switch) resign() {
+	s.setLeading(false)
+	s.shutdown()
+	db.ReleaseLeadership(s.Name, instanceID)
+}
@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestRunning(t *testing.T) {
+	defer func(mode string) { clusterMode = mode }(clusterMode)
+	tests := []struct {
+		name    string
+		mode    string
+		leading bool
+		done    bool
+		want    bool
+	}{
+		{"single", singleMode, false, false, true},
+		{"sharded", shardedMode, false, false, true},
+		{"ha leader", haMode, true, false, true},
+		{"ha standby", haMode, false, false, false},
+		{"stopped", singleMode, false, true, false},
+		{"stopped ha leader", haMode, true, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clusterMode = tt.mode
+			s := &Switch{done: make(chan struct{})}
+			s.setLeading(tt.leading)
+			if tt.done {
+				close(s.done)
+			}
+			if got := s.running(); got != tt.want {
+				t.Errorf("running() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package logger
+
+import (
+	"log/slog"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces the values of the sensitive attributes
+const Redacted = "[REDACTED]"
+
+// PayloadKey attribute of the logged CSTA payloads, redacted before being written
+const PayloadKey = "payload"
+
+// sensitiveKeys attributes never written
+var sensitiveKeys = map[string]bool{
+	"password":      true,
+	"secret":        true,
+	"token":         true,
+	"apikey":        true,
+	"authorization": true,
+}
+
+var (
+	credentialsPattern = regexp.MustCompile(`<((?:\w+:)?(?:password|userName))>[^<]*</`)
+	urlPattern         = regexp.MustCompile(`://([^:/@\s]+):[^@\s]*@`)
+)
+
+// Redactor masks sensitive data of a payload
+type Redactor func(string) string
+
+var (
+	redactors     = []Redactor{redactCredentials}
+	redactorsLock sync.RWMutex
+	payloads      bool
+)
+
+// Logger structured logger of a component
+type Logger struct {
+	*slog.Logger
+}
+
+func init() {
+	level := new(slog.LevelVar)
+	switch strings.ToLower(os.Getenv("LOG_LEVEL")) {
+	case "debug":
+		level.Set(slog.LevelDebug)
+	case "warn":
+		level.Set(slog.LevelWarn)
+	case "error":
+		level.Set(slog.LevelError)
+	}
+	payloads, _ = strconv.ParseBool(os.Getenv("LOG_PAYLOADS"))
+
+	options := &slog.HandlerOptions{Level: level, ReplaceAttr: replaceAttr}
+	var handler slog.Handler
+	if strings.ToLower(os.Getenv("LOG_FORMAT")) == "text" {
+		handler = slog.NewTextHandler(os.Stdout, options)
+	} else {
+		handler = slog.NewJSONHandler(os.Stdout, options)
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+// New logger of the component
+func New(component string) *Logger {
+	return &Logger{slog.Default().With("component", component)}
+}
+
+// With fields added to every record
+func (l *Logger) With(args ...interface{}) *Logger {
+	return &Logger{l.Logger.With(args...)}
+}
+
+// Fatal logs the error and exits
+func (l *Logger) Fatal(msg string, args ...interface{}) {
+	l.Error(msg, args...)
+	os.Exit(1)
+}
+
+// Payloads logged with the frames exchanged with the providers (LOG_PAYLOADS)
+func Payloads() bool {
+	return payloads
+}
+
+// AddRedactor applied to every logged payload
+func AddRedactor(r Redactor) {
+	redactorsLock.Lock()
+	defer redactorsLock.Unlock()
+	redactors = append(redactors, r)
+}
+
+// Redact the sensitive data of a payload
+func Redact(payload string) string {
+	redactorsLock.RLock()
+	defer redactorsLock.RUnlock()
+	for _, r := range redactors {
+		payload = r(payload)
+	}
+	return payload
+}
+
+func redactCredentials(payload string) string {
+	payload = credentialsPattern.ReplaceAllString(payload, "<$1>"+Redacted+"</")
+	return urlPattern.ReplaceAllString(payload, "://$1:"+Redacted+"@")
+}
+
+// replaceAttr hides the sensitive attributes and redacts the strings and errors
+func replaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if sensitiveKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, Redacted)
+	}
+	switch v := a.Value.Any().(type) {
+	case string:
+		return slog.String(a.Key, Redact(v))
+	case error:
+		return slog.String(a.Key, Redact(v.Error()))
+	}
+	return a
+}
@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Frames exchanged with the CTI providers by direction and message type
+	Frames = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cti_provider_frames_total",
+		Help: "Frames exchanged with the CTI providers by direction and message type.",
+	}, []string{"provider", "direction", "type"})
+
+	// RequestDuration of the requests to the CTI providers by operation
+	RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "cti_request_duration_seconds",
+		Help:    "Duration of the requests to the CTI providers by operation.",
+		Buckets: []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"switch", "operation", "result"})
+
+	// CSTAErrors responses by error category
+	CSTAErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cti_csta_errors_total",
+		Help: "CSTA error responses by error category.",
+	}, []string{"category"})
+
+	// ActiveMonitors by switch and extension type
+	ActiveMonitors = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cti_active_monitors",
+		Help: "Monitors active on this instance by switch and extension type.",
+	}, []string{"switch", "type"})
+
+	// Heartbeats of the application sessions by result
+	Heartbeats = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cti_session_heartbeats_total",
+		Help: "Application session timer resets by switch and result.",
+	}, []string{"switch", "result"})
+
+	// LastHeartbeat of the application sessions
+	LastHeartbeat = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cti_session_last_heartbeat_timestamp_seconds",
+		Help: "Time of the last successful application session timer reset by switch.",
+	}, []string{"switch"})
+
+	// Reconnects of the application sessions by result
+	Reconnects = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cti_session_reconnects_total",
+		Help: "Attempts to restart the application sessions by switch and result.",
+	}, []string{"switch", "result"})
+
+	// Published events by result
+	Published = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cti_rabbitmq_published_total",
+		Help: "Events published to RabbitMQ by result.",
+	}, []string{"result"})
+)
+
+func init() {
+	prometheus.MustRegister(Frames, RequestDuration, CSTAErrors, ActiveMonitors, Heartbeats, LastHeartbeat, Reconnects, Published)
+}
+
+// Result label of an operation
+func Result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
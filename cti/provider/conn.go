@@ -2,25 +2,46 @@ package provider
 
 import (
 	"bufio"
+	"crypto/tls"
 	"encoding/binary"
 	"io"
-	"log"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/rresender/csta-integration/cti/logger"
+	"github.com/rresender/csta-integration/cti/metrics"
 )
 
+var log = logger.New("provider")
+
+func init() {
+	logger.AddRedactor(RedactDigits)
+}
+
 // Listener for listen to event
 type Listener interface {
 	DoProcess(invokeID string, data string)
 }
 
+// ConnectionListener notified when the connection is lost
+type ConnectionListener interface {
+	ConnectionLost(err error)
+}
+
 var connectionTimeout = 15 * time.Second
 
-var (
+// Connection to a CTI Provider
+type Connection struct {
+	host string
 	conn net.Conn
 	out  *bufio.Writer
 	in   *bufio.Reader
-)
+	lock sync.Mutex
+
+	closed int32
+}
 
 func writeShort(v int, w *bufio.Writer) error {
 	var err error
@@ -32,7 +53,7 @@ func writeShort(v int, w *bufio.Writer) error {
 func write(v string, w *bufio.Writer) error {
 	_, err := w.Write([]byte(v))
 	if err != nil {
-		log.Printf("Error while sending data %v ", err)
+		log.Error("error while sending data", "error", err)
 		//TODO Implement reconnect
 	}
 	return err
@@ -41,88 +62,172 @@ func write(v string, w *bufio.Writer) error {
 func read(r *bufio.Reader, length int) ([]byte, error) {
 	data := make([]byte, length)
 	_, err := io.ReadFull(r, data)
-	if err != nil {
-		if err == io.EOF {
-			log.Fatalln(err)
-		}
-		log.Printf("Error while reading data %v ", err)
-		//TODO Implement reconnect
-	}
 	return data, err
 }
 
 func readShort(r *bufio.Reader) (uint16, error) {
-	buff, err := read(in, 2)
+	buff, err := read(r, 2)
 	data := binary.BigEndian.Uint16(buff)
 	return data, err
 }
 
-// Connect to CTI Provider
-func Connect(host string, listener Listener) error {
-	log.Printf("Connecting to Provider: %s...\n", host)
+// frameTypes of the metrics, the raw console sends any root element and the other ones are counted as "other"
+var frameTypes = make(map[string]bool)
+
+func init() {
+	for _, name := range []string{
+		// requests and their responses
+		"StartApplicationSession", "StartApplicationSessionPosResponse", "StartApplicationSessionNegResponse",
+		"StopApplicationSession", "StopApplicationSessionPosResponse", "StopApplicationSessionNegResponse",
+		"ResetApplicationSessionTimer", "ResetApplicationSessionTimerPosResponse", "ResetApplicationSessionTimerNegResponse",
+		"GetDeviceId", "GetDeviceIdResponse", "MonitorStart", "MonitorStartResponse", "MonitorStop", "MonitorStopResponse",
+		"SnapshotCall", "SnapshotCallResponse", "SnapshotDevice", "SnapshotDeviceResponse",
+		"RouteRegister", "RouteRegisterResponse", "RouteRegisterCancel", "RouteRegisterCancelResponse",
+		"RouteSelect", "RouteEndRequest", "RouteRequest", "ReRoute", "RouteEnd", "RouteUsed",
+		"GetDoNotDisturb", "GetDoNotDisturbResponse", "SetDoNotDisturb", "SetDoNotDisturbResponse",
+		"GetForwarding", "GetForwardingResponse", "SetForwarding", "SetForwardingResponse",
+		"GetMessageWaitingIndicator", "GetMessageWaitingIndicatorResponse",
+		"SetMessageWaitingIndicator", "SetMessageWaitingIndicatorResponse",
+		"QueryDeviceInfo", "QueryDeviceInfoResponse", "GenerateDigits", "GenerateDigitsResponse",
+		"MakeCall", "MakeCallResponse", "SingleStepTransferCall", "SingleStepTransferCallResponse",
+		"AnswerCall", "AnswerCallResponse", "ClearConnection", "ClearConnectionResponse",
+		"HoldCall", "HoldCallResponse", "RetrieveCall", "RetrieveCallResponse",
+		"CSTAErrorCode", "SystemStatus", "SystemStatusResponse",
+		// events
+		"DeliveredEvent", "EstablishedEvent", "ConnectionClearedEvent", "CallClearedEvent", "TransferredEvent",
+		"ConferencedEvent", "DivertedEvent", "FailedEvent", "HeldEvent", "NetworkReachedEvent", "OriginatedEvent",
+		"QueuedEvent", "RetrievedEvent", "ServiceInitiatedEvent", "DigitsGeneratedEvent", "EnteredDigitsEvent",
+		"AgentLoggedOnEvent", "AgentLoggedOffEvent", "AgentReadyEvent", "AgentNotReadyEvent", "AgentWorkingAfterCallEvent",
+		"DoNotDisturbEvent", "ForwardingEvent", "MessageWaitingEvent", "MonitorEndedEvent",
+	} {
+		frameTypes[name] = true
+	}
+}
+
+// frameType of a frame by the root element of its payload
+func frameType(data string) string {
+	name := MessageName(data)
+	switch {
+	case name == "":
+		return "unknown"
+	case frameTypes[name]:
+		return name
+	}
+	return "other"
+}
+
+// Connect to CTI Provider, over TLS when tlsConfig is not nil
+func Connect(host string, tlsConfig *tls.Config, listener Listener) (*Connection, error) {
+	log.Info("connecting to provider", "provider", host, "tls", tlsConfig != nil)
+	var conn net.Conn
 	var err error
-	conn, err = net.DialTimeout("tcp", host, connectionTimeout)
+	if tlsConfig != nil {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: connectionTimeout}, "tcp", host, tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", host, connectionTimeout)
+	}
 	if err != nil {
-		log.Fatalln(err)
 		//TODO Implement reconnect
+		return nil, err
+	}
+	c := &Connection{
+		host: host,
+		conn: conn,
+		out:  bufio.NewWriter(conn),
+		in:   bufio.NewReader(conn),
 	}
-	out = bufio.NewWriter(conn)
-	in = bufio.NewReader(conn)
 
-	responseHandler(listener)
+	c.responseHandler(listener)
 
-	return err
+	return c, nil
 }
 
 // Send messaged to CTI Provider with a specific reader
-func Send(invokeID string, message string) error {
+func (c *Connection) Send(invokeID string, message string) error {
 	/*
 	 * The Header is  8 bytes long.
 	 * | 1 | 2 | 3 | 4 | 5 | 6 | 7 | 8 |
 	 * |VERSION|LENGTH |   INVOKE ID   |   XML PAYLOAD
 	 */
-	log.Println("=============== REQUEST ===============")
-	log.Printf("(%s)\n", message)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.logFrame("request", invokeID, message)
+	metrics.Frames.WithLabelValues(c.host, "out", frameType(message)).Inc()
 	var err error
-	err = writeShort(0, out)
-	err = writeShort(len(message)+8, out)
-	err = write(invokeID, out)
-	err = write(message, out)
-	out.Flush()
-	log.Println("=======================================")
+	err = writeShort(0, c.out)
+	err = writeShort(len(message)+8, c.out)
+	err = write(invokeID, c.out)
+	err = write(message, c.out)
+	if flushErr := c.out.Flush(); err == nil {
+		err = flushErr
+	}
 	return err
 }
 
+func (c *Connection) readFrame() (uint16, uint16, []byte, []byte, error) {
+	version, err := readShort(c.in)
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+	length, err := readShort(c.in)
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+	invokeID, err := read(c.in, 4)
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+	data, err := read(c.in, int(length-8))
+	return version, length, invokeID, data, err
+}
+
+// logFrame at debug level, with its redacted payload when LOG_PAYLOADS is enabled
+func (c *Connection) logFrame(direction string, invokeID string, data string, args ...interface{}) {
+	args = append(args, "provider", c.host, "invokeID", invokeID, "type", frameType(data))
+	if logger.Payloads() {
+		args = append(args, logger.PayloadKey, data)
+	}
+	log.Debug(direction, args...)
+}
+
 // ResponseHandler to handle responses
-func responseHandler(listener Listener) {
+func (c *Connection) responseHandler(listener Listener) {
 	go func(listener Listener) {
 		for {
 
-			var err error
-			version, err := readShort(in)
-			length, err := readShort(in)
-			invokeID, err := read(in, 4)
-			data, err := read(in, int(length-8))
+			version, length, invokeID, data, err := c.readFrame()
+
+			if err != nil && atomic.LoadInt32(&c.closed) == 1 {
+				return
+			}
 
 			switch err {
 			case nil:
-				log.Println("=============== RESPONSE ===============")
-				log.Printf(" VERSION: %d\n", version)
-				log.Printf("  LENGTH: %d\n", length)
-				log.Printf("INVOKEID: %s\n", string(invokeID))
-				log.Printf("    DATA: %s\n", string(data))
-				log.Println("=======================================")
+				c.logFrame("response", string(invokeID), string(data), "version", version, "length", length)
+				metrics.Frames.WithLabelValues(c.host, "in", frameType(string(data))).Inc()
 				go listener.DoProcess(string(invokeID), string(data))
 			default:
-				log.Fatalf("error while receiving data: %s", err)
-				//TODO implement reconnect
+				cl, ok := listener.(ConnectionListener)
+				if !ok {
+					log.Fatal("error while receiving data", "provider", c.host, "error", err)
+				}
+				log.Error("error while receiving data", "provider", c.host, "error", err)
+				c.Close()
+				cl.ConnectionLost(err)
+				return
 			}
 
 		}
 	}(listener)
 }
 
+// Closed connection
+func (c *Connection) Closed() bool {
+	return atomic.LoadInt32(&c.closed) == 1
+}
+
 // Close the connection
-func Close() {
-	conn.Close()
+func (c *Connection) Close() {
+	atomic.StoreInt32(&c.closed, 1)
+	c.conn.Close()
 }
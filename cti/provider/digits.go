@@ -0,0 +1,50 @@
+package provider
+
+import (
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// digitsPattern elements carrying DTMF digits in requests and events
+var digitsPattern = regexp.MustCompile(`<(charactersToSend|digitsGeneratedList|digits)>([^<]*)</`)
+
+// validDigits DTMF characters accepted by GenerateDigits
+var validDigits = regexp.MustCompile(`^[0-9A-Da-d*#]+$`)
+
+var digitsRedaction int32
+
+// SetDigitsRedaction masks the DTMF digits of the logged messages and of the parsed digits events
+func SetDigitsRedaction(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&digitsRedaction, v)
+}
+
+// DigitsRedaction enabled
+func DigitsRedaction() bool {
+	return atomic.LoadInt32(&digitsRedaction) == 1
+}
+
+// ValidDigits to be sent by GenerateDigits
+func ValidDigits(digits string) bool {
+	return validDigits.MatchString(digits)
+}
+
+// MaskDigits keeping their length
+func MaskDigits(digits string) string {
+	return strings.Repeat("*", len(digits))
+}
+
+// RedactDigits masks the DTMF digits of a message when the redaction is enabled
+func RedactDigits(data string) string {
+	if !DigitsRedaction() {
+		return data
+	}
+	return digitsPattern.ReplaceAllStringFunc(data, func(element string) string {
+		match := digitsPattern.FindStringSubmatch(element)
+		return "<" + match[1] + ">" + MaskDigits(match[2]) + "</"
+	})
+}
@@ -0,0 +1,220 @@
+package provider
+
+import (
+	"encoding/xml"
+	"errors"
+	"strings"
+)
+
+// CSTA error categories of a CSTAErrorCode
+const (
+	OperationCategory                      = "operation"
+	SecurityCategory                       = "security"
+	StateIncompatibilityCategory           = "stateIncompatibility"
+	SystemResourceAvailabilityCategory     = "systemResourceAvailability"
+	SubscribedResourceAvailabilityCategory = "subscribedResourceAvailability"
+	PerformanceManagementCategory          = "performanceManagement"
+	PrivateDataCategory                    = "privateData"
+	UnspecifiedCategory                    = "unspecified"
+)
+
+// Category errors matched by errors.Is for every value of the category
+var (
+	ErrOperation                      = errors.New("csta operation error")
+	ErrSecurity                       = errors.New("csta security error")
+	ErrStateIncompatibility           = errors.New("csta state incompatibility error")
+	ErrSystemResourceAvailability     = errors.New("csta system resource availability error")
+	ErrSubscribedResourceAvailability = errors.New("csta subscribed resource availability error")
+	ErrPerformanceManagement          = errors.New("csta performance management error")
+	ErrPrivateData                    = errors.New("csta private data error")
+	ErrUnspecified                    = errors.New("csta unspecified error")
+)
+
+// Common errors matched by errors.Is for the related values
+var (
+	ErrInvalidDevice = errors.New("invalid device")
+	ErrInvalidCall   = errors.New("call or connection not found")
+	ErrResourceBusy  = errors.New("resource busy")
+	ErrNotAllowed    = errors.New("not allowed")
+)
+
+var categoryErrors = map[string]error{
+	OperationCategory:                      ErrOperation,
+	SecurityCategory:                       ErrSecurity,
+	StateIncompatibilityCategory:           ErrStateIncompatibility,
+	SystemResourceAvailabilityCategory:     ErrSystemResourceAvailability,
+	SubscribedResourceAvailabilityCategory: ErrSubscribedResourceAvailability,
+	PerformanceManagementCategory:          ErrPerformanceManagement,
+	PrivateDataCategory:                    ErrPrivateData,
+	UnspecifiedCategory:                    ErrUnspecified,
+}
+
+var valueErrors = map[string]error{
+	"invalidDeviceID":                   ErrInvalidDevice,
+	"invalidCallingDevice":              ErrInvalidDevice,
+	"invalidCalledDevice":               ErrInvalidDevice,
+	"invalidDestination":                ErrInvalidDevice,
+	"invalidForwardingDestination":      ErrInvalidDevice,
+	"invalidMonitorObject":              ErrInvalidDevice,
+	"invalidAssociatedCallingDevice":    ErrInvalidDevice,
+	"resourceBusy":                      ErrResourceBusy,
+	"networkBusy":                       ErrResourceBusy,
+	"resourceLimitExceeded":             ErrResourceBusy,
+	"noActiveCall":                      ErrInvalidCall,
+	"invalidCallID":                     ErrInvalidCall,
+	"invalidConnectionID":               ErrInvalidCall,
+	"requestIncompatibleWithObject":     ErrNotAllowed,
+	"requestIncompatibleWithDevice":     ErrNotAllowed,
+	"privilegeViolationSpecifiedDevice": ErrNotAllowed,
+	"privilegeViolationOnCallingDevice": ErrNotAllowed,
+	"privilegeViolationOnCalledDevice":  ErrNotAllowed,
+	"serviceNotSupported":               ErrNotAllowed,
+	"securityViolation":                 ErrNotAllowed,
+}
+
+// CSTAError error of a CSTAErrorCode response with its category and value
+type CSTAError struct {
+	Category string
+	Value    string
+}
+
+func (e *CSTAError) Error() string {
+	if e.Value == "" {
+		return "csta error: " + e.Category
+	}
+	return "csta error: " + e.Category + ": " + e.Value
+}
+
+// Is matches the category and common errors of the value
+func (e *CSTAError) Is(target error) bool {
+	if t, ok := target.(*CSTAError); ok {
+		return t.Category == e.Category && (t.Value == "" || t.Value == e.Value)
+	}
+	return target == categoryErrors[e.Category] || target == valueErrors[e.Value]
+}
+
+// parseCSTAError from a CSTAErrorCode message
+func parseCSTAError(data string) (*CSTAError, bool) {
+	decoder := xml.NewDecoder(strings.NewReader(data))
+	var cstaErr *CSTAError
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return cstaErr, cstaErr != nil
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if cstaErr == nil {
+				if t.Name.Local != "CSTAErrorCode" {
+					return nil, false
+				}
+				cstaErr = &CSTAError{Category: UnspecifiedCategory}
+				continue
+			}
+			var value string
+			if err := decoder.DecodeElement(&value, &t); err != nil {
+				return nil, false
+			}
+			cstaErr.Category = t.Name.Local
+			if cstaErr.Category == "systemResourceAvailibility" {
+				cstaErr.Category = SystemResourceAvailabilityCategory
+			}
+			cstaErr.Value = strings.TrimSpace(value)
+			return cstaErr, true
+		}
+	}
+}
+
+// ECMA-354 defined errors of the application session services
+const (
+	InvalidApplicationInfo               = "invalidApplicationInfo"
+	RequestedProtocolVersionNotSupported = "requestedProtocolVersionNotSupported"
+	InvalidSessionID                     = "invalidSessionID"
+	ResourceLimitation                   = "resourceLimitation"
+)
+
+// Session errors matched by errors.Is for the related defined errors
+var (
+	ErrInvalidApplicationInfo      = errors.New("invalid application info")
+	ErrProtocolVersionNotSupported = errors.New("protocol version not supported")
+	ErrInvalidSessionID            = errors.New("invalid session ID")
+	ErrSessionResourceLimitation   = errors.New("session resource limitation")
+)
+
+var sessionErrors = map[string]error{
+	InvalidApplicationInfo:               ErrInvalidApplicationInfo,
+	RequestedProtocolVersionNotSupported: ErrProtocolVersionNotSupported,
+	InvalidSessionID:                     ErrInvalidSessionID,
+	ResourceLimitation:                   ErrSessionResourceLimitation,
+}
+
+var sessionErrorHints = map[string]string{
+	InvalidApplicationInfo:               "check the user and password of the switch (switches[].user/password in the configuration file or CTI_USER/CTI_PASSWORD) and the application ID",
+	RequestedProtocolVersionNotSupported: "the provider does not support the requested CSTA protocol version",
+	InvalidSessionID:                     "the session is unknown to the provider, a new session is required",
+	ResourceLimitation:                   "the provider has reached its session or license limit",
+}
+
+// SessionError negative response of an ECMA-354 application session service
+type SessionError struct {
+	Service      string
+	DefinedError string
+	Other        string
+}
+
+func (e *SessionError) Error() string {
+	reason := e.DefinedError
+	if reason == "" {
+		reason = e.Other
+	}
+	if reason == "" {
+		reason = "unspecified"
+	}
+	if hint, ok := sessionErrorHints[e.DefinedError]; ok {
+		return e.Service + " failed: " + reason + " (" + hint + ")"
+	}
+	return e.Service + " failed: " + reason
+}
+
+// Is matches the errors of the defined error
+func (e *SessionError) Is(target error) bool {
+	if t, ok := target.(*SessionError); ok {
+		return (t.Service == "" || t.Service == e.Service) && (t.DefinedError == "" || t.DefinedError == e.DefinedError)
+	}
+	return target == sessionErrors[e.DefinedError]
+}
+
+// sessionNegResponse NegResponse of the application session services
+type sessionNegResponse struct {
+	XMLName      xml.Name
+	DefinedError string `xml:"errorCode>definedError"`
+	Other        string `xml:"errorCode>other"`
+}
+
+// parseSessionError from an ECMA-354 NegResponse message
+func parseSessionError(data string) (*SessionError, bool) {
+	name := MessageName(data)
+	if !strings.HasSuffix(name, "NegResponse") {
+		return nil, false
+	}
+	var response sessionNegResponse
+	if err := xml.Unmarshal([]byte(data), &response); err != nil {
+		return nil, false
+	}
+	return &SessionError{
+		Service:      strings.TrimSuffix(name, "NegResponse"),
+		DefinedError: strings.TrimSpace(response.DefinedError),
+		Other:        strings.TrimSpace(response.Other),
+	}, true
+}
+
+// ResponseError CSTAError or SessionError of a response, nil for any other response
+func ResponseError(data string) error {
+	if cstaErr, ok := parseCSTAError(data); ok {
+		return cstaErr
+	}
+	if sessionErr, ok := parseSessionError(data); ok {
+		return sessionErr
+	}
+	return nil
+}
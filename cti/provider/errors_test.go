@@ -0,0 +1,124 @@
+package provider
+
+import (
+	"errors"
+	"testing"
+)
+
+const cstaNamespace = `xmlns="http://www.ecma-international.org/standards/ecma-323/csta/ed3"`
+
+func TestParseCSTAError(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		want   *CSTAError
+		wantOK bool
+	}{
+		{"operation", `<CSTAErrorCode ` + cstaNamespace + `><operation>invalidDeviceID</operation></CSTAErrorCode>`,
+			&CSTAError{Category: OperationCategory, Value: "invalidDeviceID"}, true},
+		{"spaces", `<CSTAErrorCode><stateIncompatibility> noActiveCall </stateIncompatibility></CSTAErrorCode>`,
+			&CSTAError{Category: StateIncompatibilityCategory, Value: "noActiveCall"}, true},
+		{"misspelled category", `<CSTAErrorCode><systemResourceAvailibility>resourceBusy</systemResourceAvailibility></CSTAErrorCode>`,
+			&CSTAError{Category: SystemResourceAvailabilityCategory, Value: "resourceBusy"}, true},
+		{"no category", `<CSTAErrorCode></CSTAErrorCode>`, &CSTAError{Category: UnspecifiedCategory}, true},
+		{"xml declaration", `<?xml version="1.0" encoding="UTF-8"?><CSTAErrorCode><security>securityViolation</security></CSTAErrorCode>`,
+			&CSTAError{Category: SecurityCategory, Value: "securityViolation"}, true},
+		{"other response", `<MakeCallResponse><callingDevice><callID>1</callID></callingDevice></MakeCallResponse>`, nil, false},
+		{"not xml", `error`, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseCSTAError(tt.data)
+			if ok != tt.wantOK {
+				t.Fatalf("parseCSTAError() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && *got != *tt.want {
+				t.Errorf("parseCSTAError() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSTAErrorIs(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    *CSTAError
+		target error
+		want   bool
+	}{
+		{"category", &CSTAError{Category: OperationCategory, Value: "invalidDeviceID"}, ErrOperation, true},
+		{"other category", &CSTAError{Category: OperationCategory, Value: "invalidDeviceID"}, ErrSecurity, false},
+		{"invalid device", &CSTAError{Category: OperationCategory, Value: "invalidDeviceID"}, ErrInvalidDevice, true},
+		{"invalid destination", &CSTAError{Category: OperationCategory, Value: "invalidDestination"}, ErrInvalidDevice, true},
+		{"no active call", &CSTAError{Category: StateIncompatibilityCategory, Value: "noActiveCall"}, ErrInvalidCall, true},
+		{"no active call not busy", &CSTAError{Category: StateIncompatibilityCategory, Value: "noActiveCall"}, ErrResourceBusy, false},
+		{"invalid call ID", &CSTAError{Category: OperationCategory, Value: "invalidCallID"}, ErrInvalidCall, true},
+		{"invalid connection ID", &CSTAError{Category: OperationCategory, Value: "invalidConnectionID"}, ErrInvalidCall, true},
+		{"resource busy", &CSTAError{Category: SystemResourceAvailabilityCategory, Value: "resourceBusy"}, ErrResourceBusy, true},
+		{"not allowed", &CSTAError{Category: SecurityCategory, Value: "securityViolation"}, ErrNotAllowed, true},
+		{"unknown value", &CSTAError{Category: OperationCategory, Value: "generic"}, ErrInvalidDevice, false},
+		{"unspecified", &CSTAError{Category: UnspecifiedCategory}, ErrUnspecified, true},
+		{"same category", &CSTAError{Category: OperationCategory, Value: "invalidDeviceID"}, &CSTAError{Category: OperationCategory}, true},
+		{"same value", &CSTAError{Category: OperationCategory, Value: "invalidDeviceID"}, &CSTAError{Category: OperationCategory, Value: "invalidDeviceID"}, true},
+		{"other value", &CSTAError{Category: OperationCategory, Value: "invalidDeviceID"}, &CSTAError{Category: OperationCategory, Value: "invalidCallID"}, false},
+		{"unrelated error", &CSTAError{Category: OperationCategory, Value: "invalidDeviceID"}, errors.New("invalid device"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errors.Is(tt.err, tt.target); got != tt.want {
+				t.Errorf("errors.Is(%v, %v) = %v, want %v", tt.err, tt.target, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResponseError(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		target error
+	}{
+		{"csta error", `<CSTAErrorCode><operation>invalidCallID</operation></CSTAErrorCode>`, ErrInvalidCall},
+		{"session error", `<StartApplicationSessionNegResponse><errorCode><definedError>invalidApplicationInfo</definedError></errorCode></StartApplicationSessionNegResponse>`,
+			ErrInvalidApplicationInfo},
+		{"session limit", `<ResetApplicationSessionTimerNegResponse><errorCode><definedError>resourceLimitation</definedError></errorCode></ResetApplicationSessionTimerNegResponse>`,
+			ErrSessionResourceLimitation},
+		{"positive response", `<MonitorStartResponse><monitorCrossRefID>1</monitorCrossRefID></MonitorStartResponse>`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ResponseError(tt.data)
+			if tt.target == nil {
+				if err != nil {
+					t.Errorf("ResponseError() = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.target) {
+				t.Errorf("ResponseError() = %v, want %v", err, tt.target)
+			}
+		})
+	}
+}
+
+func TestSessionErrorIs(t *testing.T) {
+	err := &SessionError{Service: "StartApplicationSession", DefinedError: InvalidSessionID}
+	tests := []struct {
+		name   string
+		target error
+		want   bool
+	}{
+		{"defined error", ErrInvalidSessionID, true},
+		{"other defined error", ErrInvalidApplicationInfo, false},
+		{"same service", &SessionError{Service: "StartApplicationSession"}, true},
+		{"other service", &SessionError{Service: "StopApplicationSession"}, false},
+		{"any service", &SessionError{DefinedError: InvalidSessionID}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errors.Is(err, tt.target); got != tt.want {
+				t.Errorf("errors.Is(%v, %v) = %v, want %v", err, tt.target, got, tt.want)
+			}
+		})
+	}
+}
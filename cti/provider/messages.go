@@ -3,8 +3,10 @@ package provider
 import (
 	"bytes"
 	"encoding/xml"
-	"errors"
-	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rresender/csta-integration/cti/metrics"
 )
 
 // StartApplicationSessionResponse StartApplicationSessionResponse
@@ -18,7 +20,7 @@ type StartApplicationSessionResponse struct {
 
 // StopApplicationSessionResponse StopApplicationSessionResponse
 type StopApplicationSessionResponse struct {
-	XMLName xml.Name `xml:"<StopApplicationSessionPosResponse"`
+	XMLName xml.Name `xml:"StopApplicationSessionPosResponse"`
 	Xmlns   string   `xml:"xmlns,attr"`
 }
 
@@ -56,6 +58,176 @@ type ResetApplicationSessionTimerResponse struct {
 	ActualSessionDuration int      `xml:"actualSessionDuration"`
 }
 
+// ConnectionID ConnectionID
+type ConnectionID struct {
+	CallID   string `xml:"callID" json:"callID"`
+	DeviceID string `xml:"deviceID" json:"deviceID"`
+}
+
+// MakeCallResponse MakeCallResponse
+type MakeCallResponse struct {
+	XMLName       xml.Name     `xml:"MakeCallResponse"`
+	CallingDevice ConnectionID `xml:"callingDevice"`
+}
+
+// SingleStepTransferCallResponse SingleStepTransferCallResponse
+type SingleStepTransferCallResponse struct {
+	XMLName         xml.Name     `xml:"SingleStepTransferCallResponse"`
+	TransferredCall ConnectionID `xml:"transferredCall"`
+}
+
+// SnapshotDeviceResponseInfo call of a SnapshotDeviceResponse
+type SnapshotDeviceResponseInfo struct {
+	ConnectionIdentifier ConnectionID `xml:"connectionIdentifier"`
+	LocalConnectionState string       `xml:"localCallState>compoundCallState>localConnectionState"`
+}
+
+// SnapshotDeviceResponse SnapshotDeviceResponse
+type SnapshotDeviceResponse struct {
+	XMLName xml.Name                     `xml:"SnapshotDeviceResponse"`
+	Calls   []SnapshotDeviceResponseInfo `xml:"crossRefIDorSnapshotData>snapshotData>snapshotDeviceResponseInfo"`
+}
+
+// SnapshotCallResponseInfo device of a SnapshotCallResponse
+type SnapshotCallResponseInfo struct {
+	DeviceOnCall         string       `xml:"deviceOnCall>deviceIdentifier"`
+	CallIdentifier       ConnectionID `xml:"callIdentifier"`
+	LocalConnectionState string       `xml:"localConnectionState"`
+}
+
+// SnapshotCallResponse SnapshotCallResponse
+type SnapshotCallResponse struct {
+	XMLName       xml.Name                   `xml:"SnapshotCallResponse"`
+	Devices       []SnapshotCallResponseInfo `xml:"crossRefIDorSnapshotData>snapshotData>snapshotCallResponseInfo"`
+	CallingDevice string                     `xml:"callingDevice>deviceIdentifier"`
+	CalledDevice  string                     `xml:"calledDevice>deviceIdentifier"`
+	UCID          string                     `xml:"callLinkageData>globalCallData>globalCallLinkageID>globallyUniqueCallLinkageID"`
+}
+
+// RouteRegisterResponse RouteRegisterResponse
+type RouteRegisterResponse struct {
+	XMLName            xml.Name `xml:"RouteRegisterResponse"`
+	RouteRegisterReqID string   `xml:"routeRegisterReqID"`
+}
+
+// RouteRegisterCancelResponse RouteRegisterCancelResponse
+type RouteRegisterCancelResponse struct {
+	XMLName xml.Name `xml:"RouteRegisterCancelResponse"`
+}
+
+// RouteRequest RouteRequest or ReRoute sent by the switch to the routing server
+type RouteRequest struct {
+	XMLName            xml.Name
+	RouteRegisterReqID string       `xml:"crossRefIdentifier"`
+	RoutingCrossRefID  string       `xml:"routingCrossRefID"`
+	CurrentRoute       string       `xml:"currentRoute>deviceIdentifier"`
+	CallingDevice      string       `xml:"callingDevice>deviceIdentifier"`
+	RoutedCall         ConnectionID `xml:"routedCall"`
+	UserData           string       `xml:"userData>string"`
+	UCID               string       `xml:"callLinkageData>globalCallData>globalCallLinkageID>globallyUniqueCallLinkageID"`
+}
+
+// RouteEnd RouteEnd sent by the switch when a routing dialog ends
+type RouteEnd struct {
+	XMLName            xml.Name `xml:"RouteEnd"`
+	RouteRegisterReqID string   `xml:"crossRefIdentifier"`
+	RoutingCrossRefID  string   `xml:"routingCrossRefID"`
+	ErrorValue         string   `xml:"errorValue>operation"`
+}
+
+// GetDoNotDisturbResponse GetDoNotDisturbResponse
+type GetDoNotDisturbResponse struct {
+	XMLName        xml.Name `xml:"GetDoNotDisturbResponse"`
+	DoNotDisturbOn bool     `xml:"doNotDisturbOn"`
+}
+
+// SetDoNotDisturbResponse SetDoNotDisturbResponse
+type SetDoNotDisturbResponse struct {
+	XMLName xml.Name `xml:"SetDoNotDisturbResponse"`
+}
+
+// ForwardListItem ForwardListItem
+type ForwardListItem struct {
+	ForwardingType string `xml:"forwardingType"`
+	ForwardStatus  bool   `xml:"forwardStatus"`
+	ForwardDN      string `xml:"forwardDN"`
+}
+
+// GetForwardingResponse GetForwardingResponse
+type GetForwardingResponse struct {
+	XMLName        xml.Name          `xml:"GetForwardingResponse"`
+	ForwardingList []ForwardListItem `xml:"forwardingList>forwardListItem"`
+}
+
+// SetForwardingResponse SetForwardingResponse
+type SetForwardingResponse struct {
+	XMLName xml.Name `xml:"SetForwardingResponse"`
+}
+
+// GetMessageWaitingIndicatorResponse GetMessageWaitingIndicatorResponse
+type GetMessageWaitingIndicatorResponse struct {
+	XMLName          xml.Name `xml:"GetMessageWaitingIndicatorResponse"`
+	MessageWaitingOn bool     `xml:"messageWaitingOn"`
+}
+
+// SetMessageWaitingIndicatorResponse SetMessageWaitingIndicatorResponse
+type SetMessageWaitingIndicatorResponse struct {
+	XMLName xml.Name `xml:"SetMessageWaitingIndicatorResponse"`
+}
+
+// QueryDeviceInfoResponse QueryDeviceInfoResponse
+type QueryDeviceInfoResponse struct {
+	XMLName         xml.Name `xml:"QueryDeviceInfoResponse"`
+	Device          string   `xml:"device"`
+	DeviceCategory  string   `xml:"deviceCategory"`
+	ModelName       string   `xml:"modelName"`
+	MaxActiveCalls  int      `xml:"maxActiveCalls"`
+	MaxHeldCalls    int      `xml:"maxHeldCalls"`
+	AssociatedClass string   `xml:"associatedClass"`
+}
+
+// GenerateDigitsResponse GenerateDigitsResponse
+type GenerateDigitsResponse struct {
+	XMLName xml.Name `xml:"GenerateDigitsResponse"`
+}
+
+// AnswerCallResponse AnswerCallResponse
+type AnswerCallResponse struct {
+	XMLName xml.Name `xml:"AnswerCallResponse"`
+}
+
+// ClearConnectionResponse ClearConnectionResponse
+type ClearConnectionResponse struct {
+	XMLName xml.Name `xml:"ClearConnectionResponse"`
+}
+
+// HoldCallResponse HoldCallResponse
+type HoldCallResponse struct {
+	XMLName xml.Name `xml:"HoldCallResponse"`
+}
+
+// RetrieveCallResponse RetrieveCallResponse
+type RetrieveCallResponse struct {
+	XMLName xml.Name `xml:"RetrieveCallResponse"`
+}
+
+// DigitsGeneratedEvent DigitsGeneratedEvent
+type DigitsGeneratedEvent struct {
+	XMLName             xml.Name     `xml:"DigitsGeneratedEvent" json:"-"`
+	MonitorCrossRefID   string       `xml:"monitorCrossRefID" json:"monitorCrossRefID"`
+	Connection          ConnectionID `xml:"connection" json:"connection"`
+	DigitsGeneratedList string       `xml:"digitsGeneratedList" json:"digitsGeneratedList"`
+}
+
+// EnteredDigitsEvent EnteredDigitsEvent
+type EnteredDigitsEvent struct {
+	XMLName           xml.Name     `xml:"EnteredDigitsEvent" json:"-"`
+	MonitorCrossRefID string       `xml:"monitorCrossRefID" json:"monitorCrossRefID"`
+	Connection        ConnectionID `xml:"connection" json:"connection"`
+	Device            string       `xml:"device>deviceIdentifier" json:"device"`
+	Digits            string       `xml:"digits" json:"digits"`
+}
+
 // CSTAErrorCodeResponse CSTAErrorCodeResponse
 type CSTAErrorCodeResponse struct {
 	XMLName                        xml.Name `xml:"CSTAErrorCode"`
@@ -70,41 +242,48 @@ type CSTAErrorCodeResponse struct {
 	Unspecified                    string   `xml:"unspecified"`
 }
 
+// escape the value of an element of a message, the values come from the API and the provider
+func escape(value string) string {
+	var escaped strings.Builder
+	xml.EscapeText(&escaped, []byte(value))
+	return escaped.String()
+}
+
 //StartApplicationSessionMessage StartApplicationSessionMessage
 func StartApplicationSessionMessage(appName string, user string, password string, sessionCleanupDelay string, requestedSessionDuration string) string {
 	var message bytes.Buffer
 	message.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>")
 	message.WriteString("<StartApplicationSession xmlns=\"http://www.ecma-international.org/standards/ecma-354/appl_session\">")
 	message.WriteString("<applicationInfo>")
-	message.WriteString("<applicationID>" + appName + "</applicationID>")
+	message.WriteString("<applicationID>" + escape(appName) + "</applicationID>")
 	message.WriteString("<applicationSpecificInfo>")
 	message.WriteString("<ns1:SessionLoginInfo ")
 	message.WriteString("xmlns:ns1=\"http://www.pbxnsip.com/schemas/csta\" ")
 	message.WriteString("xmlns:xsi=\"http://www.w3.org/2001/XMLSchema-instance\" ")
 	message.WriteString("xsi:type=\"ns1:SessionLoginInfo\">")
-	message.WriteString("<ns1:userName>" + user + "</ns1:userName>")
-	message.WriteString("<ns1:password>" + password + "</ns1:password>")
-	message.WriteString("<ns1:sessionCleanupDelay>" + sessionCleanupDelay + "</ns1:sessionCleanupDelay>")
+	message.WriteString("<ns1:userName>" + escape(user) + "</ns1:userName>")
+	message.WriteString("<ns1:password>" + escape(password) + "</ns1:password>")
+	message.WriteString("<ns1:sessionCleanupDelay>" + escape(sessionCleanupDelay) + "</ns1:sessionCleanupDelay>")
 	message.WriteString("</ns1:SessionLoginInfo>")
 	message.WriteString("</applicationSpecificInfo>")
 	message.WriteString("</applicationInfo>")
 	message.WriteString("<requestedProtocolVersions>")
 	message.WriteString("<protocolVersion>http://www.ecma-international.org/standards/ecma-323/csta/ed3/priv5</protocolVersion>")
 	message.WriteString("</requestedProtocolVersions>")
-	message.WriteString("<requestedSessionDuration>" + requestedSessionDuration + "</requestedSessionDuration>")
+	message.WriteString("<requestedSessionDuration>" + escape(requestedSessionDuration) + "</requestedSessionDuration>")
 	message.WriteString("</StartApplicationSession>")
 	return message.String()
 }
 
 // ResetApplicationSessionTimerMessage ResetApplicationSessionTimerMessage
-func ResetApplicationSessionTimerMessage(sessionID string) string {
+func ResetApplicationSessionTimerMessage(sessionID string, requestedSessionDuration string) string {
 	var message bytes.Buffer
 	message.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>")
-	message.WriteString("<ResetApplicationSessionTimer xmlns:xsi=\"http://www.w3.org/2001/XMLSchema-instance\" xmlns:xsd=\"http://www.w3.org/2001/XMLSchema\" xmlns=\"http://www.ecma-international.org/standards/ecma- 354/appl_session\">")
+	message.WriteString("<ResetApplicationSessionTimer xmlns:xsi=\"http://www.w3.org/2001/XMLSchema-instance\" xmlns:xsd=\"http://www.w3.org/2001/XMLSchema\" xmlns=\"http://www.ecma-international.org/standards/ecma-354/appl_session\">")
 	message.WriteString("<sessionID>")
-	message.WriteString(sessionID)
+	message.WriteString(escape(sessionID))
 	message.WriteString("</sessionID>")
-	message.WriteString("<requestedSessionDuration>180</requestedSessionDuration>")
+	message.WriteString("<requestedSessionDuration>" + escape(requestedSessionDuration) + "</requestedSessionDuration>")
 	message.WriteString("</ResetApplicationSessionTimer>")
 	return message.String()
 }
@@ -114,38 +293,51 @@ func GetDeviceIDMessage(callServerIP string, extension string) string {
 	var message bytes.Buffer
 	message.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>")
 	message.WriteString("<GetDeviceId xmlns=\"http://www.pbxnsip.com/schemas/csta\">")
-	message.WriteString("<switchName>" + callServerIP + "</switchName>")
-	message.WriteString("<extension>" + extension + "</extension>")
+	message.WriteString("<switchName>" + escape(callServerIP) + "</switchName>")
+	message.WriteString("<extension>" + escape(extension) + "</extension>")
 	message.WriteString("</GetDeviceId>")
 	return message.String()
 }
 
-// MonitorVDNStartMessage MonitorVDNStartMessage
-func MonitorVDNStartMessage(deviceID string) string {
+// CallControlEvents of the monitor filter of a VDN, all of them are reported by default
+var CallControlEvents = []string{
+	"callCleared",
+	"conferenced",
+	"connectionCleared",
+	"delivered",
+	"diverted",
+	"established",
+	"failed",
+	"held",
+	"networkReached",
+	"originated",
+	"queued",
+	"retrieved",
+	"serviceInitiated",
+	"transferred",
+}
+
+// MonitorVDNStartMessage MonitorVDNStartMessage, only the given call control events are reported, all of them when none is given
+func MonitorVDNStartMessage(deviceID string, events []string) string {
+	reported := make(map[string]bool)
+	for _, event := range events {
+		reported[event] = true
+	}
 	var message bytes.Buffer
 	message.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>")
 	message.WriteString("<MonitorStart xmlns=\"http://www.ecma-international.org/standards/ecma-323/csta/ed3\">")
 	message.WriteString("<monitorObject>")
 	message.WriteString("<deviceObject typeOfNumber=\"other\" mediaClass=\"notKnown\" bitRate=\"constant\">")
-	message.WriteString(deviceID)
+	message.WriteString(escape(deviceID))
 	message.WriteString("</deviceObject>")
 	message.WriteString("</monitorObject>")
 	message.WriteString("<requestedMonitorFilter>")
 	message.WriteString("<callcontrol>")
-	message.WriteString("<callCleared>true</callCleared>")
-	message.WriteString("<conferenced>true</conferenced>")
-	message.WriteString("<connectionCleared>true</connectionCleared>")
-	message.WriteString("<delivered>true</delivered>")
-	message.WriteString("<diverted>true</diverted>")
-	message.WriteString("<established>true</established>")
-	message.WriteString("<failed>true</failed>")
-	message.WriteString("<held>true</held>")
-	message.WriteString("<networkReached>true</networkReached>")
-	message.WriteString("<originated>true</originated>")
-	message.WriteString("<queued>true</queued>")
-	message.WriteString("<retrieved>true</retrieved>")
-	message.WriteString("<serviceInitiated>true</serviceInitiated>")
-	message.WriteString("<transferred>true</transferred>")
+	for _, event := range CallControlEvents {
+		message.WriteString("<" + event + ">")
+		message.WriteString(strconv.FormatBool(len(events) == 0 || reported[event]))
+		message.WriteString("</" + event + ">")
+	}
 	message.WriteString("</callcontrol>")
 	message.WriteString("<callAssociated>")
 	message.WriteString("<callInformation>true</callInformation>")
@@ -180,7 +372,7 @@ func MonitorSkillStartMessage(deviceID string) string {
 	message.WriteString("<MonitorStart xmlns=\"http://www.ecma-international.org/standards/ecma-323/csta/ed3\">")
 	message.WriteString("<monitorObject>")
 	message.WriteString("<deviceObject typeOfNumber=\"other\" mediaClass=\"notKnown\" bitRate=\"constant\">")
-	message.WriteString(deviceID)
+	message.WriteString(escape(deviceID))
 	message.WriteString("</deviceObject>")
 	message.WriteString("</monitorObject>")
 	message.WriteString("<requestedMonitorFilter>")
@@ -196,19 +388,269 @@ func MonitorStopMessage(monitorID string) string {
 	message.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>")
 	message.WriteString("<MonitorStop xmlns=\"hhttp://www.pbxnsip.com/schemas/csta\">")
 	message.WriteString("<monitorCrossRefID>")
-	message.WriteString(monitorID)
+	message.WriteString(escape(monitorID))
 	message.WriteString("</monitorCrossRefID>")
 	message.WriteString("</MonitorStop>")
 	return message.String()
 }
 
+// SnapshotDeviceMessage SnapshotDeviceMessage
+func SnapshotDeviceMessage(deviceID string) string {
+	var message bytes.Buffer
+	message.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>")
+	message.WriteString("<SnapshotDevice xmlns=\"http://www.ecma-international.org/standards/ecma-323/csta/ed3\">")
+	message.WriteString("<snapshotObject typeOfNumber=\"other\" mediaClass=\"notKnown\" bitRate=\"constant\">")
+	message.WriteString(escape(deviceID))
+	message.WriteString("</snapshotObject>")
+	message.WriteString("</SnapshotDevice>")
+	return message.String()
+}
+
+// SnapshotCallMessage SnapshotCallMessage
+func SnapshotCallMessage(callID string, deviceID string) string {
+	var message bytes.Buffer
+	message.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>")
+	message.WriteString("<SnapshotCall xmlns=\"http://www.ecma-international.org/standards/ecma-323/csta/ed3\">")
+	message.WriteString("<snapshotObject>")
+	message.WriteString("<callID>" + escape(callID) + "</callID>")
+	message.WriteString("<deviceID>" + escape(deviceID) + "</deviceID>")
+	message.WriteString("</snapshotObject>")
+	message.WriteString("</SnapshotCall>")
+	return message.String()
+}
+
+// RouteRegisterMessage RouteRegisterMessage
+func RouteRegisterMessage(routeingDevice string) string {
+	var message bytes.Buffer
+	message.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>")
+	message.WriteString("<RouteRegister xmlns=\"http://www.ecma-international.org/standards/ecma-323/csta/ed3\">")
+	message.WriteString("<routeingDevice>" + escape(routeingDevice) + "</routeingDevice>")
+	message.WriteString("</RouteRegister>")
+	return message.String()
+}
+
+// RouteRegisterCancelMessage RouteRegisterCancelMessage
+func RouteRegisterCancelMessage(routeRegisterReqID string) string {
+	var message bytes.Buffer
+	message.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>")
+	message.WriteString("<RouteRegisterCancel xmlns=\"http://www.ecma-international.org/standards/ecma-323/csta/ed3\">")
+	message.WriteString("<routeRegisterReqID>" + escape(routeRegisterReqID) + "</routeRegisterReqID>")
+	message.WriteString("</RouteRegisterCancel>")
+	return message.String()
+}
+
+// RouteSelectMessage RouteSelectMessage, userData is the hex encoded UUI
+func RouteSelectMessage(routeRegisterReqID string, routingCrossRefID string, routeSelected string, userData string) string {
+	var message bytes.Buffer
+	message.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>")
+	message.WriteString("<RouteSelect xmlns=\"http://www.ecma-international.org/standards/ecma-323/csta/ed3\">")
+	message.WriteString("<crossRefIdentifier>" + escape(routeRegisterReqID) + "</crossRefIdentifier>")
+	message.WriteString("<routingCrossRefID>" + escape(routingCrossRefID) + "</routingCrossRefID>")
+	message.WriteString("<routeSelected>" + escape(routeSelected) + "</routeSelected>")
+	message.WriteString("<routeUsedReq>false</routeUsedReq>")
+	writeUserData(&message, userData)
+	message.WriteString("</RouteSelect>")
+	return message.String()
+}
+
+// RouteEndRequestMessage RouteEndRequestMessage
+func RouteEndRequestMessage(routeRegisterReqID string, routingCrossRefID string) string {
+	var message bytes.Buffer
+	message.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>")
+	message.WriteString("<RouteEndRequest xmlns=\"http://www.ecma-international.org/standards/ecma-323/csta/ed3\">")
+	message.WriteString("<crossRefIdentifier>" + escape(routeRegisterReqID) + "</crossRefIdentifier>")
+	message.WriteString("<routingCrossRefID>" + escape(routingCrossRefID) + "</routingCrossRefID>")
+	message.WriteString("<errorValue><operation>generic</operation></errorValue>")
+	message.WriteString("</RouteEndRequest>")
+	return message.String()
+}
+
+// GetDoNotDisturbMessage GetDoNotDisturbMessage
+func GetDoNotDisturbMessage(deviceID string) string {
+	var message bytes.Buffer
+	message.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>")
+	message.WriteString("<GetDoNotDisturb xmlns=\"http://www.ecma-international.org/standards/ecma-323/csta/ed3\">")
+	message.WriteString("<device>" + escape(deviceID) + "</device>")
+	message.WriteString("</GetDoNotDisturb>")
+	return message.String()
+}
+
+// SetDoNotDisturbMessage SetDoNotDisturbMessage
+func SetDoNotDisturbMessage(deviceID string, doNotDisturbOn bool) string {
+	var message bytes.Buffer
+	message.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>")
+	message.WriteString("<SetDoNotDisturb xmlns=\"http://www.ecma-international.org/standards/ecma-323/csta/ed3\">")
+	message.WriteString("<device>" + escape(deviceID) + "</device>")
+	message.WriteString("<doNotDisturbOn>" + strconv.FormatBool(doNotDisturbOn) + "</doNotDisturbOn>")
+	message.WriteString("</SetDoNotDisturb>")
+	return message.String()
+}
+
+// GetForwardingMessage GetForwardingMessage
+func GetForwardingMessage(deviceID string) string {
+	var message bytes.Buffer
+	message.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>")
+	message.WriteString("<GetForwarding xmlns=\"http://www.ecma-international.org/standards/ecma-323/csta/ed3\">")
+	message.WriteString("<device>" + escape(deviceID) + "</device>")
+	message.WriteString("</GetForwarding>")
+	return message.String()
+}
+
+// SetForwardingMessage SetForwardingMessage, forwardDN is only sent when the forwarding is activated
+func SetForwardingMessage(deviceID string, forwardingType string, activateForward bool, forwardDN string) string {
+	var message bytes.Buffer
+	message.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>")
+	message.WriteString("<SetForwarding xmlns=\"http://www.ecma-international.org/standards/ecma-323/csta/ed3\">")
+	message.WriteString("<device>" + escape(deviceID) + "</device>")
+	message.WriteString("<forwardingType>" + escape(forwardingType) + "</forwardingType>")
+	message.WriteString("<activateForward>" + strconv.FormatBool(activateForward) + "</activateForward>")
+	if activateForward && forwardDN != "" {
+		message.WriteString("<forwardDN>" + escape(forwardDN) + "</forwardDN>")
+	}
+	message.WriteString("</SetForwarding>")
+	return message.String()
+}
+
+// GetMessageWaitingIndicatorMessage GetMessageWaitingIndicatorMessage
+func GetMessageWaitingIndicatorMessage(deviceID string) string {
+	var message bytes.Buffer
+	message.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>")
+	message.WriteString("<GetMessageWaitingIndicator xmlns=\"http://www.ecma-international.org/standards/ecma-323/csta/ed3\">")
+	message.WriteString("<device>" + escape(deviceID) + "</device>")
+	message.WriteString("</GetMessageWaitingIndicator>")
+	return message.String()
+}
+
+// SetMessageWaitingIndicatorMessage SetMessageWaitingIndicatorMessage
+func SetMessageWaitingIndicatorMessage(deviceID string, messageWaitingOn bool) string {
+	var message bytes.Buffer
+	message.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>")
+	message.WriteString("<SetMessageWaitingIndicator xmlns=\"http://www.ecma-international.org/standards/ecma-323/csta/ed3\">")
+	message.WriteString("<device>" + escape(deviceID) + "</device>")
+	message.WriteString("<messageWaitingOn>" + strconv.FormatBool(messageWaitingOn) + "</messageWaitingOn>")
+	message.WriteString("</SetMessageWaitingIndicator>")
+	return message.String()
+}
+
+// QueryDeviceInfoMessage QueryDeviceInfoMessage
+func QueryDeviceInfoMessage(deviceID string) string {
+	var message bytes.Buffer
+	message.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>")
+	message.WriteString("<QueryDeviceInfo xmlns=\"http://www.ecma-international.org/standards/ecma-323/csta/ed3\">")
+	message.WriteString("<device>" + escape(deviceID) + "</device>")
+	message.WriteString("</QueryDeviceInfo>")
+	return message.String()
+}
+
+// GenerateDigitsMessage GenerateDigitsMessage
+func GenerateDigitsMessage(callID string, deviceID string, digits string) string {
+	var message bytes.Buffer
+	message.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>")
+	message.WriteString("<GenerateDigits xmlns=\"http://www.ecma-international.org/standards/ecma-323/csta/ed3\">")
+	message.WriteString("<connectionToSendDigits>")
+	message.WriteString("<callID>" + escape(callID) + "</callID>")
+	message.WriteString("<deviceID>" + escape(deviceID) + "</deviceID>")
+	message.WriteString("</connectionToSendDigits>")
+	message.WriteString("<charactersToSend>" + escape(digits) + "</charactersToSend>")
+	message.WriteString("</GenerateDigits>")
+	return message.String()
+}
+
+func writeUserData(message *bytes.Buffer, userData string) {
+	if userData == "" {
+		return
+	}
+	message.WriteString("<userData>")
+	message.WriteString("<string>" + escape(userData) + "</string>")
+	message.WriteString("</userData>")
+}
+
+// MakeCallMessage MakeCallMessage, userData is the hex encoded UUI
+func MakeCallMessage(callingDevice string, calledDirectoryNumber string, userData string) string {
+	var message bytes.Buffer
+	message.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>")
+	message.WriteString("<MakeCall xmlns=\"http://www.ecma-international.org/standards/ecma-323/csta/ed3\">")
+	message.WriteString("<callingDevice>" + escape(callingDevice) + "</callingDevice>")
+	message.WriteString("<calledDirectoryNumber>" + escape(calledDirectoryNumber) + "</calledDirectoryNumber>")
+	writeUserData(&message, userData)
+	message.WriteString("</MakeCall>")
+	return message.String()
+}
+
+// SingleStepTransferCallMessage SingleStepTransferCallMessage, userData is the hex encoded UUI
+func SingleStepTransferCallMessage(callID string, deviceID string, transferredTo string, userData string) string {
+	var message bytes.Buffer
+	message.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>")
+	message.WriteString("<SingleStepTransferCall xmlns=\"http://www.ecma-international.org/standards/ecma-323/csta/ed3\">")
+	message.WriteString("<activeCall>")
+	message.WriteString("<callID>" + escape(callID) + "</callID>")
+	message.WriteString("<deviceID>" + escape(deviceID) + "</deviceID>")
+	message.WriteString("</activeCall>")
+	message.WriteString("<transferredTo>" + escape(transferredTo) + "</transferredTo>")
+	writeUserData(&message, userData)
+	message.WriteString("</SingleStepTransferCall>")
+	return message.String()
+}
+
+// AnswerCallMessage AnswerCallMessage
+func AnswerCallMessage(callID string, deviceID string) string {
+	var message bytes.Buffer
+	message.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>")
+	message.WriteString("<AnswerCall xmlns=\"http://www.ecma-international.org/standards/ecma-323/csta/ed3\">")
+	message.WriteString("<callToBeAnswered>")
+	message.WriteString("<callID>" + escape(callID) + "</callID>")
+	message.WriteString("<deviceID>" + escape(deviceID) + "</deviceID>")
+	message.WriteString("</callToBeAnswered>")
+	message.WriteString("</AnswerCall>")
+	return message.String()
+}
+
+// ClearConnectionMessage ClearConnectionMessage
+func ClearConnectionMessage(callID string, deviceID string) string {
+	var message bytes.Buffer
+	message.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>")
+	message.WriteString("<ClearConnection xmlns=\"http://www.ecma-international.org/standards/ecma-323/csta/ed3\">")
+	message.WriteString("<connectionToBeCleared>")
+	message.WriteString("<callID>" + escape(callID) + "</callID>")
+	message.WriteString("<deviceID>" + escape(deviceID) + "</deviceID>")
+	message.WriteString("</connectionToBeCleared>")
+	message.WriteString("</ClearConnection>")
+	return message.String()
+}
+
+// HoldCallMessage HoldCallMessage
+func HoldCallMessage(callID string, deviceID string) string {
+	var message bytes.Buffer
+	message.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>")
+	message.WriteString("<HoldCall xmlns=\"http://www.ecma-international.org/standards/ecma-323/csta/ed3\">")
+	message.WriteString("<callToBeHeld>")
+	message.WriteString("<callID>" + escape(callID) + "</callID>")
+	message.WriteString("<deviceID>" + escape(deviceID) + "</deviceID>")
+	message.WriteString("</callToBeHeld>")
+	message.WriteString("</HoldCall>")
+	return message.String()
+}
+
+// RetrieveCallMessage RetrieveCallMessage
+func RetrieveCallMessage(callID string, deviceID string) string {
+	var message bytes.Buffer
+	message.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>")
+	message.WriteString("<RetrieveCall xmlns=\"http://www.ecma-international.org/standards/ecma-323/csta/ed3\">")
+	message.WriteString("<callToBeRetrieved>")
+	message.WriteString("<callID>" + escape(callID) + "</callID>")
+	message.WriteString("<deviceID>" + escape(deviceID) + "</deviceID>")
+	message.WriteString("</callToBeRetrieved>")
+	message.WriteString("</RetrieveCall>")
+	return message.String()
+}
+
 // StopAppSessionMessage StopAppSessionMessage
 func StopAppSessionMessage(sessionID string) string {
 	var message bytes.Buffer
 	message.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>")
 	message.WriteString("<StopApplicationSession xmlns=\"http://www.ecma-international.org/standards/ecma-354/appl_session\">")
 	message.WriteString("<sessionID>")
-	message.WriteString(sessionID)
+	message.WriteString(escape(sessionID))
 	message.WriteString("</sessionID>")
 	message.WriteString("<sessionEndReason>")
 	message.WriteString("<definedEndReason>normal</definedEndReason>")
@@ -217,17 +659,51 @@ func StopAppSessionMessage(sessionID string) string {
 	return message.String()
 }
 
-// ParseMessageResponse ParseMessageResponse
+// StopApplicationSessionPosResponseMessage StopApplicationSessionPosResponseMessage
+func StopApplicationSessionPosResponseMessage() string {
+	var message bytes.Buffer
+	message.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>")
+	message.WriteString("<StopApplicationSessionPosResponse xmlns=\"http://www.ecma-international.org/standards/ecma-354/appl_session\" />")
+	return message.String()
+}
+
+// StopApplicationSessionRequest StopApplicationSession sent by the provider
+type StopApplicationSessionRequest struct {
+	XMLName          xml.Name `xml:"StopApplicationSession"`
+	SessionID        string   `xml:"sessionID"`
+	DefinedEndReason string   `xml:"sessionEndReason>definedEndReason"`
+}
+
+// MessageName of the root element of a message
+func MessageName(data string) string {
+	decoder := xml.NewDecoder(strings.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local
+		}
+	}
+}
+
+// ParseMessageResponse ParseMessageResponse, a CSTAErrorCode is returned as a *CSTAError
+// and an application session NegResponse as a *SessionError
 func ParseMessageResponse(data string, response interface{}) error {
 	if err := xml.Unmarshal([]byte(data), &response); err != nil {
-		fmt.Printf("error: %v\n", err)
-		var failure CSTAErrorCodeResponse
-		if err := xml.Unmarshal([]byte(data), &failure); err != nil {
-			fmt.Printf("error: %v\n", err)
-			return err
+		if cstaErr, ok := parseCSTAError(data); ok {
+			log.Warn("csta error response", "category", cstaErr.Category, "value", cstaErr.Value)
+			metrics.CSTAErrors.WithLabelValues(cstaErr.Category).Inc()
+			return cstaErr
+		}
+		if sessionErr, ok := parseSessionError(data); ok {
+			log.Warn("application session negative response", "service", sessionErr.Service, "definedError", sessionErr.DefinedError, "other", sessionErr.Other)
+			metrics.CSTAErrors.WithLabelValues("applicationSession").Inc()
+			return sessionErr
 		}
-		fmt.Printf("CSTAErrorCodeResponse: %v\n", failure)
-		return errors.New(failure.Operation)
+		log.Error("response could not be parsed", "type", MessageName(data), "error", err)
+		return err
 	}
 	return nil
 }
@@ -2,43 +2,24 @@ package rabbitmq
 
 import (
 	"bytes"
-	"fmt"
-	"log"
-	"os"
+	"errors"
 	"time"
 
+	"github.com/rresender/csta-integration/cti/logger"
+	"github.com/rresender/csta-integration/cti/metrics"
 	"github.com/streadway/amqp"
 )
 
+var log = logger.New("rabbitmq")
+
 var (
 	conn *amqp.Connection
 	//TODO implement pool
 )
 
-func init() {
-
-	user := os.Getenv("RABBITMQ_USER")
-	if user == "" {
-		user = "guest"
-	}
-
-	password := os.Getenv("RABBITMQ_PASS")
-	if password == "" {
-		password = "guest"
-	}
-
-	address := os.Getenv("RABBITMQ_PORT_5672_TCP_ADDR")
-	if address == "" {
-		address = "rabbitmq"
-	}
-
-	tcp := os.Getenv("RABBITMQ_PORT_5672_TCP_PORT")
-	if tcp == "" {
-		tcp = "5672"
-	}
-
-	url := fmt.Sprintf("amqp://%s:%s@%s:%s/", user, password, address, tcp)
-	log.Printf("Connecting to RabbitMQ: %s...\n", url)
+// Connect to the RabbitMQ broker
+func Connect(url string) {
+	log.Info("connecting to rabbitmq", "url", url)
 
 	max := 5
 	var err error
@@ -53,7 +34,7 @@ LOOP:
 				break LOOP
 			}
 			if max == 0 {
-				log.Fatalln("Failed to connect to RabbitMQ")
+				log.Fatal("failed to connect to rabbitmq", "url", url, "error", err)
 			}
 			max--
 		}
@@ -61,17 +42,35 @@ LOOP:
 	failOnError(err, "Failed to connect to RabbitMQ")
 }
 
+// Check the health of the connection
+func Check() error {
+	if conn == nil || conn.IsClosed() {
+		return errors.New("connection to RabbitMQ is closed")
+	}
+	return nil
+}
+
 func failOnError(err error, msg string) {
 	if err != nil {
-		log.Fatalf("%s: %s", msg, err)
+		log.Fatal(msg, "error", err)
 	}
 }
 
 // Send messages to the queue
 func Send(queue string, message *bytes.Buffer) {
+	err := publish(queue, message)
+	metrics.Published.WithLabelValues(metrics.Result(err)).Inc()
+	if err != nil {
+		log.Error("failed to publish a message", "exchange", queue, "error", err)
+	}
+}
+
+func publish(queue string, message *bytes.Buffer) error {
 
 	ch, err := conn.Channel()
-	failOnError(err, "Failed to open a channel")
+	if err != nil {
+		return err
+	}
 	defer ch.Close()
 
 	err = ch.ExchangeDeclare(
@@ -83,9 +82,11 @@ func Send(queue string, message *bytes.Buffer) {
 		false,    // no-wait
 		nil,      // arguments
 	)
-	failOnError(err, "Failed to declare an exchange")
+	if err != nil {
+		return err
+	}
 
-	err = ch.Publish(
+	return ch.Publish(
 		queue, // exchange
 		"",    // routing key
 		false, // mandatory
@@ -94,8 +95,59 @@ func Send(queue string, message *bytes.Buffer) {
 			ContentType: "application/json",
 			Body:        message.Bytes(),
 		})
+}
 
-	failOnError(err, "Failed to publish a message")
+// Subscribe to the messages of an exchange through an exclusive queue, close the channel to stop
+func Subscribe(queue string) (<-chan amqp.Delivery, *amqp.Channel, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = ch.ExchangeDeclare(
+		queue,    // name
+		"fanout", // type
+		true,     // durable
+		false,    // auto-deleted
+		false,    // internal
+		false,    // no-wait
+		nil,      // arguments
+	)
+	if err != nil {
+		ch.Close()
+		return nil, nil, err
+	}
+
+	q, err := ch.QueueDeclare(
+		"",    // name
+		false, // durable
+		false, // delete when usused
+		true,  // exclusive
+		false, // no-wait
+		nil,   // arguments
+	)
+	if err == nil {
+		err = ch.QueueBind(q.Name, "", queue, false, nil)
+	}
+	if err != nil {
+		ch.Close()
+		return nil, nil, err
+	}
+
+	messages, err := ch.Consume(
+		q.Name, // queue
+		"",     // consumer
+		true,   // auto-ack
+		true,   // exclusive
+		false,  // no-local
+		false,  // no-wait
+		nil,    // args
+	)
+	if err != nil {
+		ch.Close()
+		return nil, nil, err
+	}
+	return messages, ch, nil
 }
 
 // DeleteQueue - delete queue
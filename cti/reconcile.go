@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rresender/csta-integration/cti/db"
+	"github.com/rresender/csta-integration/cti/helper"
+	"github.com/rresender/csta-integration/cti/rabbitmq"
+	"github.com/rresender/csta-integration/cti/redis"
+)
+
+// Reconciliation summary of the monitors restored by a new session
+type Reconciliation struct {
+	Switch         string
+	Time           time.Time
+	Configured     int
+	Persisted      int
+	Restored       []string
+	Failed         map[string]string
+	PurgedKeys     []string
+	RemovedEntries []string
+}
+
+func (r *Reconciliation) String() string {
+	return fmt.Sprintf("Reconciliation of %s at %s: configured: %d, persisted: %d, restored: %d %v, failed: %d %v, purged keys: %d, removed entries: %d %v",
+		r.Switch, r.Time.Format(time.RFC3339), r.Configured, r.Persisted,
+		len(r.Restored), r.Restored, len(r.Failed), r.Failed, len(r.PurgedKeys), len(r.RemovedEntries), r.RemovedEntries)
+}
+
+var (
+	reconciliations     = make(map[string]*Reconciliation)
+	reconciliationsLock sync.Mutex
+)
+
+func getReconciliation(switchName string) *Reconciliation {
+	reconciliationsLock.Lock()
+	defer reconciliationsLock.Unlock()
+	return reconciliations[switchName]
+}
+
+// loadPersisted extensions of the switch, removing list entries without a record
+func (s *Switch) loadPersisted(summary *Reconciliation) []*db.Extension {
+	var extensions []*db.Extension
+	for _, ID := range db.GetAllExtensions(s.Name) {
+		ext := db.FindExtension(s.Name, ID)
+		if ext == nil {
+			db.RemoveExtensionFromList(s.Name, ID)
+			summary.RemovedEntries = append(summary.RemovedEntries, ID)
+			continue
+		}
+		extensions = append(extensions, ext)
+	}
+	return extensions
+}
+
+// globEscaper of the special characters of the redis key patterns
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+// crossRefIDOf the cross reference key when it belongs to the switch, whatever the instance that saved it:
+// the application name of the key is the prefix, an IP address without '-' and the exact name of the switch
+func (s *Switch) crossRefIDOf(key string) (string, bool) {
+	marker := helper.GetMonitorCrossRefIDKey("", "")
+	i := strings.Index(key, marker)
+	if i < 0 || !strings.HasPrefix(key, applicationPrefix) {
+		return "", false
+	}
+	instance := key[len(applicationPrefix):i]
+	j := strings.Index(instance, "-")
+	if j < 0 || instance[j+1:] != s.Name {
+		return "", false
+	}
+	return key[i+len(marker):], true
+}
+
+// purgeCrossRefIDs removes the cross reference keys not used by any persisted monitor of the switch
+func (s *Switch) purgeCrossRefIDs(summary *Reconciliation) {
+	inUse := make(map[string]bool)
+	for _, ID := range db.GetAllExtensions(s.Name) {
+		if ext := db.FindExtension(s.Name, ID); ext != nil {
+			inUse[ext.MonitorCrossRefID] = true
+		}
+	}
+	keys, err := redis.GetKeys(helper.GetMonitorCrossRefIDKey("*", applicationPrefix+"*-"+globEscaper.Replace(s.Name)))
+	if err != nil {
+		s.log.Error("cross reference keys could not be loaded", "error", err)
+		return
+	}
+	for _, key := range keys {
+		monitorCrossRefID, ok := s.crossRefIDOf(key)
+		if !ok || inUse[monitorCrossRefID] {
+			continue
+		}
+		db.Delete(key)
+		summary.PurgedKeys = append(summary.PurgedKeys, key)
+	}
+}
+
+// reconcile re-establishes the configured and persisted monitors under the new session
+func (s *Switch) reconcile() *Reconciliation {
+	summary := &Reconciliation{Switch: s.Name, Time: time.Now(), Failed: make(map[string]string)}
+
+	summary.Configured = len(s.getExtensions())
+	persisted := s.loadPersisted(summary)
+	summary.Persisted = len(persisted)
+
+	if clusterMode == shardedMode {
+		for _, ext := range persisted {
+			db.AddDesiredExtensionIfMissing(s.Name, ext.ID, ext.Type)
+		}
+	} else {
+		for _, ext := range persisted {
+			if s.getExtension(ext.ID) == nil {
+				s.setExtension(ext)
+			}
+		}
+		for _, elem := range s.getExtensions() {
+			ext, err := s.doMonitoring(elem.ID, elem.Type)
+			if err != nil {
+				s.log.Error("monitoring could not be started", "extension", elem.ID, "type", elem.Type, "error", err)
+				summary.Failed[elem.ID] = err.Error()
+				rabbitmq.DeleteQueue(helper.GetExchangeName(s.Name, elem.ID))
+				continue
+			}
+			summary.Restored = append(summary.Restored, ext.ID)
+			s.log.Info("monitoring has been started", "extension", ext.ID, "type", ext.Type, "monitorCrossRefID", ext.MonitorCrossRefID)
+		}
+	}
+
+	s.purgeCrossRefIDs(summary)
+
+	reconciliationsLock.Lock()
+	reconciliations[s.Name] = summary
+	reconciliationsLock.Unlock()
+
+	s.log.Info("reconciliation", "configured", summary.Configured, "persisted", summary.Persisted,
+		"restored", summary.Restored, "failed", summary.Failed, "purgedKeys", len(summary.PurgedKeys), "removedEntries", summary.RemovedEntries)
+	return summary
+}
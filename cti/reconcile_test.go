@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestCrossRefIDOf(t *testing.T) {
+	s := &Switch{}
+	s.Name = "pbx1"
+	tests := []struct {
+		name string
+		key  string
+		want string
+		ok   bool
+	}{
+		{"this instance", "provider-monitoring-10.0.0.1-pbx1MonitorCrossRefID42", "42", true},
+		{"another instance", "provider-monitoring-10.0.0.2-pbx1MonitorCrossRefID7", "7", true},
+		{"switch with the same suffix", "provider-monitoring-10.0.0.1-east-pbx1MonitorCrossRefID42", "", false},
+		{"switch with the same prefix", "provider-monitoring-10.0.0.1-pbx10MonitorCrossRefID42", "", false},
+		{"other application", "other-10.0.0.1-pbx1MonitorCrossRefID42", "", false},
+		{"not a cross reference key", "provider-monitoring-10.0.0.1-pbx1invokeID42", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := s.crossRefIDOf(tt.key)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("crossRefIDOf(%q) = %q, %v, want %q, %v", tt.key, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestGlobEscaper(t *testing.T) {
+	if got, want := globEscaper.Replace(`pbx*[1]?\`), `pbx\*\[1\]\?\\`; got != want {
+		t.Errorf("globEscaper.Replace() = %q, want %q", got, want)
+	}
+}
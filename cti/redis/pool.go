@@ -1,27 +1,42 @@
 package redis
 
 import (
-	"log"
-	"os"
 	"time"
 
 	"github.com/garyburd/redigo/redis"
+	"github.com/rresender/csta-integration/cti/logger"
 )
 
+var log = logger.New("redis")
+
 var (
 	// Pool redis
 	Pool *redis.Pool
+	host string
 )
 
-func init() {
-	redisHost := os.Getenv("REDIS_HOST")
-	if redisHost == "" {
-		redisHost = "redis:6379"
-	}
+// checkTimeout of the health check connection
+const checkTimeout = 2 * time.Second
+
+// Connect the pool to the redis host
+func Connect(redisHost string) {
+	host = redisHost
 	Pool = newPool(redisHost)
 	Ping()
 }
 
+// Check the health of redis with a dedicated connection, without the retries of the pool
+func Check() error {
+	c, err := redis.Dial("tcp", host,
+		redis.DialConnectTimeout(checkTimeout), redis.DialReadTimeout(checkTimeout), redis.DialWriteTimeout(checkTimeout))
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	_, err = c.Do("PING")
+	return err
+}
+
 func newPool(server string) *redis.Pool {
 
 	return &redis.Pool{
@@ -30,7 +45,7 @@ func newPool(server string) *redis.Pool {
 		IdleTimeout: 240 * time.Second,
 
 		Dial: func() (redis.Conn, error) {
-			log.Printf("Connecting to Redis: %s...\n", server)
+			log.Info("connecting to redis", "host", server)
 			connectTicker := time.Tick(time.Second * 2)
 			var err error
 			var c redis.Conn
@@ -44,7 +59,7 @@ func newPool(server string) *redis.Pool {
 						break LOOP
 					}
 					if max == 0 {
-						log.Fatalln("Failed to connect to Redis")
+						log.Fatal("failed to connect to redis", "host", server, "error", err)
 					}
 					max--
 				}
@@ -2,7 +2,7 @@ package redis
 
 import (
 	"fmt"
-	"log"
+	"time"
 
 	"github.com/garyburd/redigo/redis"
 )
@@ -18,7 +18,7 @@ func Ping() {
 
 	_, err := redis.String(conn.Do("PING"))
 	if err != nil {
-		log.Panicf("cannot 'PING' db: %v", err)
+		log.Fatal("cannot PING redis", "error", err)
 	}
 }
 
@@ -161,7 +161,7 @@ func GetValues(key string) []string {
 
 	value, err := redis.Strings(conn.Do("SMEMBERS", key))
 	if err != nil {
-		log.Fatal(err)
+		log.Fatal("SMEMBERS failed", "key", key, "error", err)
 	}
 
 	return value
@@ -171,3 +171,200 @@ func GetValues(key string) []string {
 func Close() {
 	Pool.Close()
 }
+
+var renewLockScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+var releaseLockScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// AcquireLock for the owner when nobody holds it
+func AcquireLock(key string, owner string, ttl time.Duration) (bool, error) {
+
+	conn := Pool.Get()
+	defer conn.Close()
+
+	_, err := redis.String(conn.Do("SET", key, owner, "NX", "PX", int64(ttl/time.Millisecond)))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error acquiring lock %s: %v", key, err)
+	}
+	return true, nil
+}
+
+// RenewLock when it is still held by the owner
+func RenewLock(key string, owner string, ttl time.Duration) (bool, error) {
+
+	conn := Pool.Get()
+	defer conn.Close()
+
+	ok, err := redis.Bool(renewLockScript.Do(conn, key, owner, int64(ttl/time.Millisecond)))
+	if err != nil {
+		return false, fmt.Errorf("error renewing lock %s: %v", key, err)
+	}
+	return ok, nil
+}
+
+// ReleaseLock when it is held by the owner
+func ReleaseLock(key string, owner string) error {
+
+	conn := Pool.Get()
+	defer conn.Close()
+
+	_, err := releaseLockScript.Do(conn, key, owner)
+	return err
+}
+
+// GetString value of a key, empty when it does not exist
+func GetString(key string) string {
+
+	conn := Pool.Get()
+	defer conn.Close()
+
+	v, _ := redis.String(conn.Do("GET", key))
+	return v
+}
+
+// AddScored member into a sorted set
+func AddScored(key string, member string, score int64) error {
+
+	conn := Pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("ZADD", key, score, member)
+	if err != nil {
+		return fmt.Errorf("error adding %s to sorted set %s: %v", member, key, err)
+	}
+	return nil
+}
+
+// RemoveScored member from a sorted set
+func RemoveScored(key string, member string) error {
+
+	conn := Pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("ZREM", key, member)
+	return err
+}
+
+// GetScoredFrom members of a sorted set with score greater or equal than min, removing the others
+func GetScoredFrom(key string, min int64) ([]string, error) {
+
+	conn := Pool.Get()
+	defer conn.Close()
+
+	if _, err := conn.Do("ZREMRANGEBYSCORE", key, "-inf", fmt.Sprintf("(%d", min)); err != nil {
+		return nil, fmt.Errorf("error removing expired members of %s: %v", key, err)
+	}
+	members, err := redis.Strings(conn.Do("ZRANGEBYSCORE", key, min, "+inf"))
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving members of %s: %v", key, err)
+	}
+	return members, nil
+}
+
+// SetField of a hash
+func SetField(key string, field string, value string) error {
+
+	conn := Pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("HSET", key, field, value)
+	if err != nil {
+		return fmt.Errorf("error setting field %s of %s: %v", field, key, err)
+	}
+	return nil
+}
+
+// SetFieldNX of a hash when it does not exist
+func SetFieldNX(key string, field string, value string) error {
+
+	conn := Pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("HSETNX", key, field, value)
+	if err != nil {
+		return fmt.Errorf("error setting field %s of %s: %v", field, key, err)
+	}
+	return nil
+}
+
+// DeleteField of a hash
+func DeleteField(key string, field string) error {
+
+	conn := Pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("HDEL", key, field)
+	return err
+}
+
+// GetFields of a hash
+func GetFields(key string) (map[string]string, error) {
+
+	conn := Pool.Get()
+	defer conn.Close()
+
+	fields, err := redis.StringMap(conn.Do("HGETALL", key))
+	if err != nil {
+		return fields, fmt.Errorf("error retrieving fields of %s: %v", key, err)
+	}
+	return fields, nil
+}
+
+// StreamEntry of a stream with a single field
+type StreamEntry struct {
+	ID    string
+	Value string
+}
+
+// AppendStream an entry with a single field, returning its ID
+func AppendStream(key string, field string, value string) (string, error) {
+
+	conn := Pool.Get()
+	defer conn.Close()
+
+	ID, err := redis.String(conn.Do("XADD", key, "*", field, value))
+	if err != nil {
+		return "", fmt.Errorf("error appending to stream %s: %v", key, err)
+	}
+	return ID, nil
+}
+
+// RangeStream entries of the single field between the IDs, newest first when reverse
+func RangeStream(key string, field string, start string, end string, count int, reverse bool) ([]StreamEntry, error) {
+
+	conn := Pool.Get()
+	defer conn.Close()
+
+	var reply []interface{}
+	var err error
+	if reverse {
+		reply, err = redis.Values(conn.Do("XREVRANGE", key, end, start, "COUNT", count))
+	} else {
+		reply, err = redis.Values(conn.Do("XRANGE", key, start, end, "COUNT", count))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading stream %s: %v", key, err)
+	}
+	entries := make([]StreamEntry, 0, len(reply))
+	for _, item := range reply {
+		values, err := redis.Values(item, nil)
+		if err != nil || len(values) != 2 {
+			return nil, fmt.Errorf("error reading stream %s: unexpected entry", key)
+		}
+		ID, _ := redis.String(values[0], nil)
+		fields, _ := redis.StringMap(values[1], nil)
+		entries = append(entries, StreamEntry{ID: ID, Value: fields[field]})
+	}
+	return entries, nil
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rresender/csta-integration/cti/config"
+	"github.com/rresender/csta-integration/cti/db"
+	"github.com/rresender/csta-integration/cti/helper"
+	"github.com/rresender/csta-integration/cti/rabbitmq"
+)
+
+// configPollInterval of the modification time of the configuration files
+const configPollInterval = 5 * time.Second
+
+// Reload summary of the changes applied to the monitored extensions of a switch
+type Reload struct {
+	Switch    string
+	Time      time.Time
+	Started   []string
+	Stopped   []string
+	Restarted []string
+	Failed    map[string]string
+}
+
+func (r *Reload) String() string {
+	return fmt.Sprintf("Reload of %s at %s: started: %d %v, stopped: %d %v, restarted: %d %v, failed: %d %v",
+		r.Switch, r.Time.Format(time.RFC3339), len(r.Started), r.Started, len(r.Stopped), r.Stopped,
+		len(r.Restarted), r.Restarted, len(r.Failed), r.Failed)
+}
+
+// reloadLock serializes the reloads triggered by the signals, the file watch and the API
+var reloadLock sync.Mutex
+
+// reload the configuration and apply the changes of the API keys and of the monitored extensions of every switch,
+// the other settings require a restart of the service
+func reload(reason string) ([]*Reload, error) {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	log.Info("reloading the configuration", "reason", reason)
+	c, err := config.Load()
+	if err != nil {
+		log.Error("configuration could not be reloaded, the current one is kept", "error", err)
+		return nil, err
+	}
+	cfg := currentConfig()
+	if c.Mode != cfg.Mode || c.HTTP != cfg.HTTP || c.Redis != cfg.Redis || c.RabbitMQ != cfg.RabbitMQ ||
+		c.Routing != cfg.Routing || c.RedactDigits != cfg.RedactDigits {
+		log.Warn("only the API keys and the monitored extensions are reloaded, the other settings require a restart")
+	}
+
+	if err := c.Auth.Update(authenticator); err != nil {
+		log.Error("API keys could not be reloaded, the current ones are kept", "error", err)
+	}
+
+	configured := make(map[string]config.SwitchConfig)
+	for _, sc := range c.Switches {
+		configured[sc.Name] = sc
+	}
+	var reloads []*Reload
+	for _, s := range switches {
+		sc, ok := configured[s.Name]
+		if !ok {
+			s.log.Warn("switch has been removed from the configuration, it is kept until a restart")
+			continue
+		}
+		delete(configured, s.Name)
+		if s.settingsChanged(sc) {
+			s.log.Warn("only the monitored extensions of the switch are reloaded, the other settings require a restart")
+		}
+		summary := s.applyExtensions(sc.Extensions)
+		s.log.Info("reload", "started", summary.Started, "stopped", summary.Stopped, "restarted", summary.Restarted, "failed", summary.Failed)
+		reloads = append(reloads, summary)
+	}
+	for name := range configured {
+		log.Warn("switch has been added to the configuration, it requires a restart", "switch", name)
+	}
+	runningConfig.Store(reloaded(cfg, c))
+	return reloads, nil
+}
+
+// reloaded configuration: the running one with only the API keys and the extensions of its switches taken from c
+func reloaded(running *config.Config, c *config.Config) *config.Config {
+	next := *running
+	next.Auth = c.Auth
+	extensions := make(map[string][]config.ExtensionConfig)
+	for _, sc := range c.Switches {
+		extensions[sc.Name] = sc.Extensions
+	}
+	next.Switches = make([]config.SwitchConfig, len(running.Switches))
+	for i, sc := range running.Switches {
+		if e, ok := extensions[sc.Name]; ok {
+			sc.Extensions = e
+		}
+		next.Switches[i] = sc
+	}
+	return &next
+}
+
+// settingsChanged of the provider, the session or the routing of the switch
+func (s *Switch) settingsChanged(sc config.SwitchConfig) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return sc.ProviderHost != s.ProviderHost || sc.PBX != s.PBX || sc.User != s.User || sc.Password != s.Password ||
+		(sc.SessionDuration > 0 && sc.SessionDuration != s.SessionDuration) ||
+		(sc.SessionCleanupDelay > 0 && sc.SessionCleanupDelay != s.SessionCleanupDelay) ||
+		sc.TLS != s.TLS || !reflect.DeepEqual(sc.RoutingDevices, s.RoutingDevices)
+}
+
+// applyExtensions starts and stops only the monitors of the extensions added, removed or changed
+// in the configuration, the session and the monitors started by the API are kept
+func (s *Switch) applyExtensions(extensions []config.ExtensionConfig) *Reload {
+	summary := &Reload{Switch: s.Name, Time: time.Now(), Failed: make(map[string]string)}
+
+	s.lock.Lock()
+	previous := make(map[string]config.ExtensionConfig)
+	for _, e := range s.Extensions {
+		previous[e.ID] = e
+	}
+	s.Extensions = extensions
+	s.lock.Unlock()
+
+	var added, changed []config.ExtensionConfig
+	for _, e := range extensions {
+		p, ok := previous[e.ID]
+		switch {
+		case !ok:
+			added = append(added, e)
+		case p.Type != e.Type || !reflect.DeepEqual(p.Events, e.Events):
+			changed = append(changed, e)
+		}
+		delete(previous, e.ID)
+	}
+
+	for ID := range previous {
+		s.stopConfigured(ID, summary)
+	}
+	for _, e := range added {
+		s.startConfigured(e, false, summary)
+	}
+	for _, e := range changed {
+		s.startConfigured(e, true, summary)
+	}
+	return summary
+}
+
+func (s *Switch) startConfigured(e config.ExtensionConfig, restart bool, summary *Reload) {
+	switch {
+	case clusterMode == shardedMode:
+		db.AddDesiredExtension(s.Name, e.ID, e.Type)
+		if ext := s.getExtension(e.ID); restart && ext != nil {
+			s.releaseMonitor(ext)
+		}
+	case !s.isActive():
+		s.setExtension(&db.Extension{ID: e.ID, Type: e.Type, Switch: s.Name})
+	default:
+		if ext := s.getExtension(e.ID); !restart && ext != nil && ext.Type == e.Type && ext.MonitorCrossRefID != "" {
+			return
+		}
+		ext, err := s.doMonitoring(e.ID, e.Type)
+		if err != nil {
+			s.log.Error("monitoring could not be started", "extension", e.ID, "type", e.Type, "error", err)
+			summary.Failed[e.ID] = err.Error()
+			rabbitmq.DeleteQueue(helper.GetExchangeName(s.Name, e.ID))
+			return
+		}
+		s.log.Info("monitoring has been started", "extension", ext.ID, "type", ext.Type, "monitorCrossRefID", ext.MonitorCrossRefID)
+	}
+	if restart {
+		summary.Restarted = append(summary.Restarted, e.ID)
+	} else {
+		summary.Started = append(summary.Started, e.ID)
+	}
+}
+
+func (s *Switch) stopConfigured(ID string, summary *Reload) {
+	switch {
+	case clusterMode == shardedMode:
+		db.RemoveDesiredExtension(s.Name, ID)
+	case !s.isActive():
+		s.removeExtension(ID)
+		if clusterMode == singleMode {
+			db.RemoveExtensionFromList(s.Name, ID)
+			db.DeleteExtension(s.Name, ID)
+		}
+	default:
+		if s.getExtension(ID) == nil {
+			return
+		}
+		if _, err := s.stopMonitoring(ID); err != nil {
+			summary.Failed[ID] = err.Error()
+			return
+		}
+		s.log.Info("monitoring has been stopped", "extension", ID)
+	}
+	summary.Stopped = append(summary.Stopped, ID)
+}
+
+// watchReload reloads the configuration on SIGHUP and when one of its files is modified
+func watchReload() {
+	go func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, syscall.SIGHUP)
+		for range c {
+			reloads, err := reload("signal SIGHUP")
+			recordAudit(systemIdentity, "", "", "config.reload", "", "", reloadParams("signal SIGHUP", reloads), err)
+		}
+	}()
+
+	files := config.Files()
+	if len(files) == 0 {
+		return
+	}
+	go func() {
+		modified := make(map[string]time.Time)
+		for _, file := range files {
+			if info, err := os.Stat(file); err == nil {
+				modified[file] = info.ModTime()
+			}
+		}
+		ticker := time.NewTicker(configPollInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			for _, file := range files {
+				info, err := os.Stat(file)
+				if err != nil || info.ModTime().Equal(modified[file]) {
+					continue
+				}
+				modified[file] = info.ModTime()
+				reason := "file " + file + " has been modified"
+				reloads, err := reload(reason)
+				recordAudit(systemIdentity, "", "", "config.reload", "", "", reloadParams(reason, reloads), err)
+			}
+		}
+	}()
+}
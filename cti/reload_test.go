@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rresender/csta-integration/cti/config"
+)
+
+func TestReloaded(t *testing.T) {
+	running := &config.Config{
+		Mode: config.HAMode,
+		HTTP: config.HTTPConfig{Address: ":7700", ConsoleToken: "console"},
+		Switches: []config.SwitchConfig{
+			{Name: "east", ProviderHost: "aes-east:4721", Extensions: []config.ExtensionConfig{{ID: "5000", Type: config.VDN}}},
+			{Name: "west", ProviderHost: "aes-west:4721"},
+		},
+	}
+	c := &config.Config{
+		Mode: config.ShardedMode,
+		HTTP: config.HTTPConfig{Address: ":8800"},
+		Auth: config.AuthConfig{JWTSecret: "secret"},
+		Switches: []config.SwitchConfig{
+			{Name: "east", ProviderHost: "aes-2:4721", Extensions: []config.ExtensionConfig{{ID: "5001", Type: config.VDN}}},
+			{Name: "north", ProviderHost: "aes-north:4721"},
+		},
+	}
+
+	next := reloaded(running, c)
+	if next.Mode != config.HAMode || next.HTTP != running.HTTP {
+		t.Errorf("reloaded() = %+v, want the running mode and HTTP settings", next)
+	}
+	if next.Auth.JWTSecret != "secret" {
+		t.Errorf("reloaded() auth = %+v, want the reloaded one", next.Auth)
+	}
+	if len(next.Switches) != 2 || next.Switches[0].ProviderHost != "aes-east:4721" || next.Switches[1].Name != "west" {
+		t.Errorf("reloaded() switches = %+v, want the running switches", next.Switches)
+	}
+	if want := c.Switches[0].Extensions; !reflect.DeepEqual(next.Switches[0].Extensions, want) {
+		t.Errorf("reloaded() extensions = %v, want %v", next.Switches[0].Extensions, want)
+	}
+	if len(running.Switches[0].Extensions) != 1 || running.Switches[0].Extensions[0].ID != "5000" {
+		t.Errorf("reloaded() changed the running configuration: %+v", running.Switches[0])
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rresender/csta-integration/cti/config"
+	"github.com/rresender/csta-integration/cti/db"
+	"github.com/rresender/csta-integration/cti/provider"
+	"github.com/rresender/csta-integration/cti/uui"
+)
+
+// routerTimeout of a decision of the webhook router
+const routerTimeout = 2 * time.Second
+
+// RouteQuery call offered by a routing device to the router
+type RouteQuery struct {
+	Switch        string            `json:"switch"`
+	RoutingDevice string            `json:"routingDevice"`
+	ReRoute       bool              `json:"reRoute"`
+	CallID        string            `json:"callID"`
+	UCID          string            `json:"ucid"`
+	CallingDevice string            `json:"callingDevice"`
+	CurrentRoute  string            `json:"currentRoute"`
+	UUI           string            `json:"uui"`
+	UUIFields     map[string]string `json:"uuiFields"`
+}
+
+// Route decision of the router, an empty destination ends the routing dialog
+// leaving the call to the default treatment of the routing device
+type Route struct {
+	Destination string `json:"destination"`
+	UserData    string `json:"userData"`
+}
+
+// Router decides the destination of the calls offered by the routing devices
+type Router interface {
+	Route(query *RouteQuery) (*Route, error)
+}
+
+// router of the service, nil when no routing is configured
+var router Router
+
+// newRouter of the configuration, a webhook router takes precedence over a rules file
+func newRouter(c config.RoutingConfig) (Router, error) {
+	if c.URL != "" {
+		return &WebhookRouter{URL: c.URL, client: &http.Client{Timeout: routerTimeout}}, nil
+	}
+	if c.RulesFile != "" {
+		return loadRulesRouter(c.RulesFile)
+	}
+	return nil, nil
+}
+
+// RouteRule routes the calls matching all of its conditions, an empty condition matches any call
+type RouteRule struct {
+	Name           string            `json:"name"`
+	Switch         string            `json:"switch"`
+	RoutingDevice  string            `json:"routingDevice"`
+	CallingDevices []string          `json:"callingDevices"`
+	UUI            map[string]string `json:"uui"`
+	Destination    string            `json:"destination"`
+}
+
+func (r *RouteRule) matches(query *RouteQuery) bool {
+	if r.Switch != "" && r.Switch != query.Switch {
+		return false
+	}
+	if r.RoutingDevice != "" && r.RoutingDevice != query.RoutingDevice {
+		return false
+	}
+	if len(r.CallingDevices) > 0 {
+		matched := false
+		for _, prefix := range r.CallingDevices {
+			if strings.HasPrefix(query.CallingDevice, prefix) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	for key, value := range r.UUI {
+		if query.UUIFields[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// RulesRouter routes to the destination of the first matching rule, or to the default destination
+type RulesRouter struct {
+	Rules   []RouteRule `json:"rules"`
+	Default string      `json:"default"`
+}
+
+func loadRulesRouter(file string) (*RulesRouter, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var r RulesRouter
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("invalid routing rules file %s: %v", file, err)
+	}
+	for i, rule := range r.Rules {
+		if err := validateDestination(rule.Destination); err != nil {
+			return nil, fmt.Errorf("invalid routing rules file %s: rule %d (%s): %v", file, i, rule.Name, err)
+		}
+	}
+	if r.Default != "" {
+		if err := validateDestination(r.Default); err != nil {
+			return nil, fmt.Errorf("invalid routing rules file %s: default: %v", file, err)
+		}
+	}
+	return &r, nil
+}
+
+// Route Route
+func (r *RulesRouter) Route(query *RouteQuery) (*Route, error) {
+	for _, rule := range r.Rules {
+		if rule.matches(query) {
+			log.Debug("routing rule matched", "switch", query.Switch, "callID", query.CallID, "rule", rule.Name)
+			return &Route{Destination: rule.Destination}, nil
+		}
+	}
+	return &Route{Destination: r.Default}, nil
+}
+
+// WebhookRouter delegates the decision to an application, posting the query and reading the route as JSON
+type WebhookRouter struct {
+	URL    string
+	client *http.Client
+}
+
+// Route Route
+func (r *WebhookRouter) Route(query *RouteQuery) (*Route, error) {
+	body, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Post(r.URL, "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("routing webhook %s: %s", r.URL, resp.Status)
+	}
+	var route Route
+	if err := json.NewDecoder(resp.Body).Decode(&route); err != nil {
+		return nil, fmt.Errorf("routing webhook %s: %v", r.URL, err)
+	}
+	return &route, nil
+}
+
+func (s *Switch) getRoutingDevice(routeRegisterReqID string) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.routeRegistrations[routeRegisterReqID]
+}
+
+// registerRoutes registers the service as the routing server of the routing devices of the switch
+func (s *Switch) registerRoutes() {
+	registrations := make(map[string]string)
+	defer func() {
+		s.lock.Lock()
+		s.routeRegistrations = registrations
+		s.lock.Unlock()
+	}()
+	if len(s.RoutingDevices) == 0 {
+		return
+	}
+	if router == nil {
+		s.log.Warn("routing devices are not registered: no router is configured")
+		return
+	}
+	if clusterMode == shardedMode {
+		s.log.Warn("routing devices are not registered: routing is not supported in this mode", "mode", shardedMode)
+		return
+	}
+	for _, device := range s.RoutingDevices {
+		deviceID, err := s.getDeviceID(device)
+		if err != nil {
+			s.log.Error("routing device could not be registered", "extension", device, "error", err)
+			continue
+		}
+		var response provider.RouteRegisterResponse
+		if err := s.request(device, provider.RouteRegisterMessage(deviceID), &response); err != nil {
+			s.log.Error("routing device could not be registered", "extension", device, "error", err)
+			continue
+		}
+		registrations[response.RouteRegisterReqID] = device
+		s.log.Info("routing device has been registered", "extension", device, "routeRegisterReqID", response.RouteRegisterReqID)
+	}
+}
+
+// route answers a RouteRequest or ReRoute with the decision of the router
+func (s *Switch) route(data string) {
+	var request provider.RouteRequest
+	if err := provider.ParseMessageResponse(data, &request); err != nil {
+		s.log.Error("route request could not be parsed", "error", err)
+		return
+	}
+	query := &RouteQuery{
+		Switch:        s.Name,
+		RoutingDevice: s.getRoutingDevice(request.RouteRegisterReqID),
+		ReRoute:       request.XMLName.Local == "ReRoute",
+		CallID:        request.RoutedCall.CallID,
+		UCID:          request.UCID,
+		CallingDevice: strings.Split(request.CallingDevice, ":")[0],
+		CurrentRoute:  strings.Split(request.CurrentRoute, ":")[0],
+	}
+	if query.RoutingDevice == "" {
+		s.log.Warn("route request of an unknown registration has been ignored", "routeRegisterReqID", request.RouteRegisterReqID, "callID", query.CallID)
+		return
+	}
+	if request.UserData != "" {
+		if UUI, err := uui.Decode(request.UserData); err != nil {
+			s.log.Warn("UUI could not be decoded", "callID", query.CallID, "error", err)
+		} else {
+			query.UUI = UUI.Text()
+			query.UUIFields = UUI.Values()
+		}
+	}
+
+	conn, err := s.connection()
+	if err != nil {
+		s.log.Error("call could not be routed", "callID", query.CallID, "extension", query.RoutingDevice, "error", err)
+		return
+	}
+	var route *Route
+	if router != nil {
+		if route, err = router.Route(query); err != nil {
+			s.log.Error("call could not be routed", "callID", query.CallID, "extension", query.RoutingDevice, "error", err)
+			route = nil
+		}
+	}
+	message, err := routeResponse(&request, route)
+	if err != nil {
+		s.log.Error("call could not be routed", "callID", query.CallID, "extension", query.RoutingDevice, "error", err)
+		route = nil
+	}
+	invokeID := db.GetInvoke(query.RoutingDevice, s.appName)
+	if err := conn.Send(invokeID, message); err != nil {
+		s.log.Error("route request could not be answered", "invokeID", invokeID, "routingCrossRefID", request.RoutingCrossRefID, "error", err)
+		return
+	}
+	if route != nil && route.Destination != "" {
+		s.log.Info("call has been routed", "callID", query.CallID, "extension", query.RoutingDevice, "callingDevice", query.CallingDevice, "destination", route.Destination)
+	}
+}
+
+// routeResponse to the route request: the RouteSelect of the destination of the route, or the RouteEndRequest
+// leaving the call to the routing device without route, destination or with a destination that is not valid
+func routeResponse(request *provider.RouteRequest, route *Route) (string, error) {
+	end := provider.RouteEndRequestMessage(request.RouteRegisterReqID, request.RoutingCrossRefID)
+	if route == nil || route.Destination == "" {
+		return end, nil
+	}
+	if err := validateDestination(route.Destination); err != nil {
+		return end, err
+	}
+	return provider.RouteSelectMessage(request.RouteRegisterReqID, request.RoutingCrossRefID, route.Destination, route.UserData), nil
+}
+
+// routeEnded logs the end of a routing dialog reported by the switch
+func (s *Switch) routeEnded(data string) {
+	var end provider.RouteEnd
+	if err := provider.ParseMessageResponse(data, &end); err != nil {
+		s.log.Error("route end could not be parsed", "error", err)
+		return
+	}
+	if end.ErrorValue != "" && end.ErrorValue != "generic" {
+		s.log.Warn("routing dialog ended", "routingCrossRefID", end.RoutingCrossRefID, "extension", s.getRoutingDevice(end.RouteRegisterReqID), "errorValue", end.ErrorValue)
+	}
+}
+
+// unregisterRoutes cancels the registrations of the routing devices of the switch
+func (s *Switch) unregisterRoutes() {
+	s.lock.Lock()
+	registrations := s.routeRegistrations
+	s.routeRegistrations = nil
+	s.lock.Unlock()
+	for routeRegisterReqID, device := range registrations {
+		var response provider.RouteRegisterCancelResponse
+		if err := s.request(device, provider.RouteRegisterCancelMessage(routeRegisterReqID), &response); err != nil {
+			s.log.Error("routing device could not be unregistered", "extension", device, "error", err)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rresender/csta-integration/cti/provider"
+)
+
+func TestRouteResponse(t *testing.T) {
+	request := &provider.RouteRequest{RouteRegisterReqID: "7", RoutingCrossRefID: "42"}
+	tests := []struct {
+		name    string
+		route   *Route
+		want    string
+		wantErr bool
+	}{
+		{"no route", nil, "<RouteEndRequest", false},
+		{"no destination", &Route{UserData: "C8"}, "<RouteEndRequest", false},
+		{"selected", &Route{Destination: "49200", UserData: "C8"}, "<routeSelected>49200</routeSelected><routeUsedReq>false</routeUsedReq><userData><string>C8</string></userData>", false},
+		{"escaped user data", &Route{Destination: "49200", UserData: "</string><x>"}, "<string>&lt;/string&gt;&lt;x&gt;</string>", false},
+		{"injected destination", &Route{Destination: "49200</routeSelected><routeUsedReq>true"}, "<RouteEndRequest", true},
+		{"not a number", &Route{Destination: "sales"}, "<RouteEndRequest", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := routeResponse(request, tt.route)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("routeResponse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !strings.Contains(got, tt.want) || !strings.Contains(got, "<routingCrossRefID>42</routingCrossRefID>") {
+				t.Errorf("routeResponse() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRulesRouter(t *testing.T) {
+	r := &RulesRouter{
+		Rules: []RouteRule{
+			{Name: "vip", RoutingDevice: "65069", UUI: map[string]string{"segment": "VIP"}, Destination: "49200"},
+			{Name: "callers", Switch: "pbx1", CallingDevices: []string{"5511", "5521"}, Destination: "49201"},
+			{Name: "any", RoutingDevice: "65070", Destination: "49202"},
+		},
+		Default: "49167",
+	}
+	tests := []struct {
+		name  string
+		query RouteQuery
+		want  string
+	}{
+		{"UUI", RouteQuery{Switch: "pbx2", RoutingDevice: "65069", UUIFields: map[string]string{"segment": "VIP", "order": "1"}}, "49200"},
+		{"other UUI value", RouteQuery{Switch: "pbx2", RoutingDevice: "65069", UUIFields: map[string]string{"segment": "gold"}}, "49167"},
+		{"calling device prefix", RouteQuery{Switch: "pbx1", RoutingDevice: "65069", CallingDevice: "552199"}, "49201"},
+		{"calling device of another switch", RouteQuery{Switch: "pbx2", RoutingDevice: "65069", CallingDevice: "552199"}, "49167"},
+		{"first matching rule", RouteQuery{Switch: "pbx1", RoutingDevice: "65069", CallingDevice: "5511", UUIFields: map[string]string{"segment": "VIP"}}, "49200"},
+		{"routing device", RouteQuery{Switch: "pbx2", RoutingDevice: "65070"}, "49202"},
+		{"default", RouteQuery{Switch: "pbx2", RoutingDevice: "65071"}, "49167"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route, err := r.Route(&tt.query)
+			if err != nil || route.Destination != tt.want {
+				t.Errorf("Route() = %+v, %v, want %s", route, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadRulesRouter(t *testing.T) {
+	r, err := loadRulesRouter("routing.example.json")
+	if err != nil {
+		t.Fatalf("loadRulesRouter() error = %v", err)
+	}
+	if len(r.Rules) != 2 || r.Default != "49167" {
+		t.Errorf("loadRulesRouter() = %+v", r)
+	}
+	tests := []struct {
+		name    string
+		rules   string
+		wantErr string
+	}{
+		{"missing destination", `{"rules":[{"name":"vip"}]}`, "rule 0 (vip): destination is required"},
+		{"invalid destination", `{"rules":[{"name":"vip","destination":"49200</routeSelected>"}]}`, "rule 0 (vip)"},
+		{"invalid default", `{"default":"sales"}`, "default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "routing.json")
+			if err := os.WriteFile(file, []byte(tt.rules), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := loadRulesRouter(file); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("loadRulesRouter() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/rresender/csta-integration/cti/metrics"
+	"github.com/rresender/csta-integration/cti/provider"
+)
+
+const (
+	defaultSessionDuration     = 180
+	defaultSessionCleanupDelay = 60
+	// minKeepAliveInterval between two session timer resets
+	minKeepAliveInterval = 5 * time.Second
+	// restartBackoff before retrying a failed re-session, doubled up to maxRestartBackoff
+	restartBackoff    = 2 * time.Second
+	maxRestartBackoff = time.Minute
+)
+
+// sessionState of the application session with the provider
+type sessionState struct {
+	Duration      time.Duration
+	Started       time.Time
+	LastHeartbeat time.Time
+	LastError     string
+	Restarts      int
+}
+
+func (s *Switch) getSession() sessionState {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.session
+}
+
+// connection to the provider, closed by a concurrent shutdown once it has been taken
+func (s *Switch) connection() (*provider.Connection, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.conn == nil {
+		return nil, errNotConnected
+	}
+	return s.conn, nil
+}
+
+func (s *Switch) getSessionID() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.sessionID
+}
+
+func (s *Switch) updateSession(update func(*sessionState)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	update(&s.session)
+}
+
+// keepAliveInterval resets the timer three times within the negotiated duration
+func keepAliveInterval(duration time.Duration) time.Duration {
+	if interval := duration / 3; interval > minKeepAliveInterval {
+		return interval
+	}
+	return minKeepAliveInterval
+}
+
+func (s *Switch) negotiatedDuration(actualSessionDuration int) time.Duration {
+	if actualSessionDuration > 0 {
+		return time.Duration(actualSessionDuration) * time.Second
+	}
+	return time.Duration(s.SessionDuration) * time.Second
+}
+
+func (s *Switch) startSession() error {
+
+	message := provider.StartApplicationSessionMessage(s.appName, s.User, s.Password,
+		strconv.Itoa(s.SessionCleanupDelay), strconv.Itoa(s.SessionDuration))
+
+	var response provider.StartApplicationSessionResponse
+	if err := s.request(s.appName, message, &response); err != nil {
+		if errors.Is(err, provider.ErrInvalidApplicationInfo) {
+			s.log.Error("application session has been rejected", "error", err)
+		}
+		s.updateSession(func(state *sessionState) { state.LastError = err.Error() })
+		return err
+	}
+	duration := s.negotiatedDuration(response.ActualSessionDuration)
+	s.log.Info("application session started", "sessionID", response.SessionID, "duration", duration.String())
+	s.lock.Lock()
+	s.sessionID = response.SessionID
+	s.lock.Unlock()
+	s.updateSession(func(state *sessionState) {
+		state.Duration = duration
+		state.Started = time.Now()
+		state.LastHeartbeat = state.Started
+		state.LastError = ""
+	})
+	metrics.LastHeartbeat.WithLabelValues(s.Name).SetToCurrentTime()
+	return nil
+}
+
+func (s *Switch) stopSession() {
+	sessionID := s.getSessionID()
+	if sessionID == "" {
+		return
+	}
+	var response provider.StopApplicationSessionResponse
+	if err := s.request(s.appName, provider.StopAppSessionMessage(sessionID), &response); err != nil {
+		s.log.Error("application session could not be stopped", "sessionID", sessionID, "error", err)
+	}
+}
+
+// keepAlive resets the timer of the session within the negotiated duration, restarting the session when it fails
+func (s *Switch) keepAlive(stop chan struct{}, sessionID string) {
+	go func() {
+		timer := time.NewTimer(keepAliveInterval(s.getSession().Duration))
+		defer timer.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-timer.C:
+				message := provider.ResetApplicationSessionTimerMessage(sessionID, strconv.Itoa(s.SessionDuration))
+				var response provider.ResetApplicationSessionTimerResponse
+				if err := s.request("heartbeat", message, &response); err != nil {
+					metrics.Heartbeats.WithLabelValues(s.Name, "error").Inc()
+					s.log.Error("session timer could not be reset", "sessionID", sessionID, "error", err)
+					s.updateSession(func(state *sessionState) { state.LastError = err.Error() })
+					go s.restart("reset application session timer failed: " + err.Error())
+					return
+				}
+				duration := s.negotiatedDuration(response.ActualSessionDuration)
+				s.updateSession(func(state *sessionState) {
+					state.Duration = duration
+					state.LastHeartbeat = time.Now()
+				})
+				metrics.Heartbeats.WithLabelValues(s.Name, "success").Inc()
+				metrics.LastHeartbeat.WithLabelValues(s.Name).SetToCurrentTime()
+				timer.Reset(keepAliveInterval(duration))
+			}
+		}
+	}()
+}
+
+// providerStoppedSession acknowledges a StopApplicationSession sent by the provider and starts a new session
+func (s *Switch) providerStoppedSession(invokeID string, data string) {
+	var request provider.StopApplicationSessionRequest
+	if err := provider.ParseMessageResponse(data, &request); err != nil {
+		s.log.Error("StopApplicationSession could not be parsed", "invokeID", invokeID, "error", err)
+	}
+	conn, err := s.connection()
+	if err == nil {
+		err = conn.Send(invokeID, provider.StopApplicationSessionPosResponseMessage())
+	}
+	if err != nil {
+		s.log.Error("StopApplicationSession could not be acknowledged", "invokeID", invokeID, "error", err)
+	}
+	s.lock.Lock()
+	if request.SessionID != "" && request.SessionID != s.sessionID {
+		s.lock.Unlock()
+		s.log.Warn("session stopped by the provider is not the current session", "sessionID", request.SessionID)
+		return
+	}
+	s.sessionID = ""
+	s.lock.Unlock()
+	s.restart("session stopped by the provider: " + request.DefinedEndReason)
+}
+
+func (s *Switch) start() error {
+	tlsConfig, err := s.TLS.Config()
+	if err != nil {
+		return err
+	}
+	conn, err := provider.Connect(s.ProviderHost, tlsConfig, &Handler{sw: s})
+	if err != nil {
+		return err
+	}
+	stop := make(chan struct{})
+	s.lock.Lock()
+	s.conn = conn
+	s.stop = stop
+	s.active = true
+	s.lock.Unlock()
+
+	if err := s.startSession(); err != nil {
+		s.shutdown()
+		return err
+	}
+
+	s.keepAlive(stop, s.getSessionID())
+
+	s.registerRoutes()
+	s.reconcile()
+	return nil
+}
+
+// shutdown the session keeping the persisted monitors for the next session
+func (s *Switch) shutdown() {
+	s.lock.Lock()
+	if !s.active {
+		s.lock.Unlock()
+		return
+	}
+	s.active = false
+	close(s.stop)
+	conn := s.conn
+	s.lock.Unlock()
+
+	s.unregisterRoutes()
+	s.stopSession()
+	s.lock.Lock()
+	s.sessionID = ""
+	s.lock.Unlock()
+	conn.Close()
+}
+
+// running while the service has not been stopped and, in ha mode, the instance is leading
+func (s *Switch) running() bool {
+	select {
+	case <-s.done:
+		return false
+	default:
+	}
+	return clusterMode != haMode || s.isLeading()
+}
+
+// restart the session and restore its monitors, retrying with backoff until it succeeds
+func (s *Switch) restart(reason string) {
+	s.lock.Lock()
+	if s.restarting {
+		s.lock.Unlock()
+		return
+	}
+	s.restarting = true
+	s.lock.Unlock()
+	defer func() {
+		s.lock.Lock()
+		s.restarting = false
+		s.lock.Unlock()
+	}()
+
+	s.log.Warn("session will be restarted", "reason", reason)
+	s.shutdown()
+	if clusterMode == shardedMode {
+		s.clearExtensions()
+	}
+
+	backoff := restartBackoff
+	for s.running() {
+		err := s.start()
+		metrics.Reconnects.WithLabelValues(s.Name, metrics.Result(err)).Inc()
+		if err == nil {
+			s.updateSession(func(state *sessionState) { state.Restarts++ })
+			s.log.Info("session has been restarted")
+			return
+		}
+		s.log.Error("session could not be restarted", "error", err, "retryIn", backoff.String())
+		select {
+		case <-s.done:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxRestartBackoff {
+			backoff = maxRestartBackoff
+		}
+	}
+}
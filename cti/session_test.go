@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rresender/csta-integration/cti/config"
+)
+
+func TestKeepAliveInterval(t *testing.T) {
+	tests := []struct {
+		name     string
+		duration time.Duration
+		want     time.Duration
+	}{
+		{"default duration", defaultSessionDuration * time.Second, time.Minute},
+		{"a third of the duration", 30 * time.Second, 10 * time.Second},
+		{"minimum", 15 * time.Second, minKeepAliveInterval},
+		{"below the minimum", 6 * time.Second, minKeepAliveInterval},
+		{"no duration", 0, minKeepAliveInterval},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := keepAliveInterval(tt.duration); got != tt.want {
+				t.Errorf("keepAliveInterval(%s) = %s, want %s", tt.duration, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNegotiatedDuration(t *testing.T) {
+	s := &Switch{SwitchConfig: config.SwitchConfig{SessionDuration: defaultSessionDuration}}
+	tests := []struct {
+		name   string
+		actual int
+		want   time.Duration
+	}{
+		{"provider duration", 90, 90 * time.Second},
+		{"requested duration without a provider duration", 0, defaultSessionDuration * time.Second},
+		{"negative provider duration", -1, defaultSessionDuration * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.negotiatedDuration(tt.actual); got != tt.want {
+				t.Errorf("negotiatedDuration(%d) = %s, want %s", tt.actual, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"hash/fnv"
+	"sort"
+	"time"
+
+	"github.com/rresender/csta-integration/cti/db"
+)
+
+func (s *Switch) getExtension(ID string) *db.Extension {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.extensions[ID]
+}
+
+// owner of the extension among the members using rendezvous hashing
+func owner(extension string, members []string) string {
+	var selected string
+	var max uint64
+	for _, member := range members {
+		h := fnv.New64a()
+		h.Write([]byte(member))
+		h.Write([]byte{0})
+		h.Write([]byte(extension))
+		if score := mix(h.Sum64()); selected == "" || score > max {
+			selected, max = member, score
+		}
+	}
+	return selected
+}
+
+// mix the bits of the hash, FNV alone spreads the last bytes of the extension too little
+// to balance the extensions among the members
+func mix(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// Ownership of an extension in the cluster of a switch
+type Ownership struct {
+	Extension string
+	Type      string
+	Owner     string
+	Active    bool
+}
+
+func (s *Switch) getOwnership() ([]string, []Ownership) {
+	members := db.GetMembers(s.Name, leaseTTL)
+	desired := db.GetDesiredExtensions(s.Name)
+	ownership := make([]Ownership, 0, len(desired))
+	for ID, extType := range desired {
+		o := Ownership{Extension: ID, Type: extType, Owner: owner(ID, members)}
+		if ext := db.FindExtension(s.Name, ID); ext != nil && ext.Owner == o.Owner {
+			o.Active = true
+		}
+		ownership = append(ownership, o)
+	}
+	sort.Slice(ownership, func(i, j int) bool {
+		return ownership[i].Extension < ownership[j].Extension
+	})
+	sort.Strings(members)
+	return members, ownership
+}
+
+// seedDesired hands the configured extensions over to the cluster
+func (s *Switch) seedDesired() {
+	for _, ext := range s.getExtensions() {
+		db.AddDesiredExtensionIfMissing(s.Name, ext.ID, ext.Type)
+		s.removeExtension(ext.ID)
+	}
+}
+
+// shard joins the cluster of the switch and keeps monitoring the extensions owned by this instance
+func (s *Switch) shard() {
+	db.JoinCluster(s.Name, instanceID)
+	s.log.Info("instance joined the cluster", "instance", instanceID)
+
+	go func() {
+		ticker := time.NewTicker(leaseRenewal)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+			}
+			if !s.isActive() {
+				continue
+			}
+			db.JoinCluster(s.Name, instanceID)
+			s.rebalance()
+		}
+	}()
+}
+
+// rebalance starts the monitors assigned to this instance and releases the others
+func (s *Switch) rebalance() {
+	members := db.GetMembers(s.Name, leaseTTL)
+	desired := db.GetDesiredExtensions(s.Name)
+
+	for _, ext := range s.getExtensions() {
+		if _, ok := desired[ext.ID]; ok && owner(ext.ID, members) == instanceID {
+			continue
+		}
+		s.log.Info("releasing the monitor", "extension", ext.ID, "monitorCrossRefID", ext.MonitorCrossRefID)
+		s.releaseMonitor(ext)
+	}
+
+	for ID, extType := range desired {
+		if owner(ID, members) != instanceID || s.getExtension(ID) != nil {
+			continue
+		}
+		ext, err := s.doMonitoring(ID, extType)
+		if err != nil {
+			s.log.Error("monitoring could not be started", "extension", ID, "type", extType, "error", err)
+			continue
+		}
+		s.log.Info("monitoring has been started", "extension", ext.ID, "type", ext.Type, "monitorCrossRefID", ext.MonitorCrossRefID)
+	}
+}
+
+// leave the cluster of the switch handing its monitors over to the other members
+func (s *Switch) leave() {
+	db.LeaveCluster(s.Name, instanceID)
+	if !s.isActive() {
+		return
+	}
+	for _, ext := range s.getExtensions() {
+		s.releaseMonitor(ext)
+	}
+	s.shutdown()
+}
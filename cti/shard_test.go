@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestOwner(t *testing.T) {
+	members := []string{"cti-a", "cti-b", "cti-c"}
+	tests := []struct {
+		name    string
+		members []string
+		want    string
+	}{
+		{"no members", nil, ""},
+		{"one member", []string{"cti-a"}, "cti-a"},
+		{"same owner in any order", []string{"cti-c", "cti-a", "cti-b"}, owner("5000", members)},
+		{"kept when another member leaves", without(members, otherThan(owner("5000", members), members)), owner("5000", members)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := owner("5000", tt.members); got != tt.want {
+				t.Errorf("owner() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOwnerRebalance(t *testing.T) {
+	members := []string{"cti-a", "cti-b", "cti-c"}
+	tests := []struct {
+		name     string
+		members  []string
+		minMoved int
+		maxMoved int
+	}{
+		{"member leaves", []string{"cti-a", "cti-b"}, 1, 1500},
+		{"member joins", append(members, "cti-d"), 1, 1500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			owned := make(map[string]int)
+			moved := 0
+			for i := 0; i < 3000; i++ {
+				extension := fmt.Sprint(1000 + i)
+				before, after := owner(extension, members), owner(extension, tt.members)
+				owned[after]++
+				if before != after {
+					moved++
+					if contains(members, after) && contains(tt.members, before) {
+						t.Fatalf("extension %s moved from %s to %s, both members before and after", extension, before, after)
+					}
+				}
+			}
+			if moved < tt.minMoved || moved > tt.maxMoved {
+				t.Errorf("%d extensions moved, want between %d and %d", moved, tt.minMoved, tt.maxMoved)
+			}
+			for _, member := range tt.members {
+				if fair := 3000 / len(tt.members); owned[member] < fair*8/10 {
+					t.Errorf("%s owns %d of 3000 extensions", member, owned[member])
+				}
+			}
+		})
+	}
+}
+
+func without(members []string, removed string) []string {
+	var kept []string
+	for _, member := range members {
+		if member != removed {
+			kept = append(kept, member)
+		}
+	}
+	return kept
+}
+
+func otherThan(member string, members []string) string {
+	for _, m := range members {
+		if m != member {
+			return m
+		}
+	}
+	return ""
+}
+
+func contains(members []string, member string) bool {
+	for _, m := range members {
+		if m == member {
+			return true
+		}
+	}
+	return false
+}
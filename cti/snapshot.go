@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/rresender/csta-integration/cti/db"
+	"github.com/rresender/csta-integration/cti/helper"
+	"github.com/rresender/csta-integration/cti/provider"
+	"github.com/rresender/csta-integration/cti/rabbitmq"
+)
+
+// DeviceSnapshot device on a call and its connection state
+type DeviceSnapshot struct {
+	Device string
+	State  string
+}
+
+// CallSnapshot call in progress on a monitored device
+type CallSnapshot struct {
+	CallID        string
+	UCID          string
+	CallingDevice string
+	CalledDevice  string
+	State         string
+	Devices       []DeviceSnapshot
+}
+
+// Snapshot of the calls in progress on an extension when its monitoring starts
+type Snapshot struct {
+	Extension string
+	Type      string
+	Switch    string
+	Time      time.Time
+	Calls     []CallSnapshot
+}
+
+// snapshot of the calls in progress on the device of the extension
+func (s *Switch) snapshot(ext *db.Extension) (*Snapshot, error) {
+	var device provider.SnapshotDeviceResponse
+	if err := s.request(ext.ID, provider.SnapshotDeviceMessage(ext.DeviceID), &device); err != nil {
+		return nil, err
+	}
+	snapshot := &Snapshot{Extension: ext.ID, Type: ext.Type, Switch: s.Name, Time: time.Now()}
+	for _, info := range device.Calls {
+		call := CallSnapshot{CallID: info.ConnectionIdentifier.CallID, State: info.LocalConnectionState}
+		var response provider.SnapshotCallResponse
+		message := provider.SnapshotCallMessage(info.ConnectionIdentifier.CallID, info.ConnectionIdentifier.DeviceID)
+		if err := s.request(ext.ID, message, &response); err != nil {
+			s.log.Error("call could not be snapshotted", "extension", ext.ID, "callID", call.CallID, "error", err)
+		} else {
+			call.UCID = response.UCID
+			call.CallingDevice = response.CallingDevice
+			call.CalledDevice = response.CalledDevice
+			for _, d := range response.Devices {
+				call.Devices = append(call.Devices, DeviceSnapshot{Device: d.DeviceOnCall, State: d.LocalConnectionState})
+			}
+		}
+		snapshot.Calls = append(snapshot.Calls, call)
+	}
+	return snapshot, nil
+}
+
+// publishSnapshot seeds the consumers of the extension with the calls already in progress
+func (s *Switch) publishSnapshot(ext *db.Extension) (*Snapshot, error) {
+	snapshot, err := s.snapshot(ext)
+	if err != nil {
+		s.log.Error("snapshot failed", "extension", ext.ID, "error", err)
+		return nil, err
+	}
+	event, err := json.Marshal(map[string]*Snapshot{"SnapshotEvent": snapshot})
+	if err != nil {
+		return nil, err
+	}
+	rabbitmq.Send(helper.GetExchangeName(s.Name, ext.ID), bytes.NewBuffer(event))
+	s.log.Info("snapshot published", "extension", ext.ID, "calls", len(snapshot.Calls))
+	return snapshot, nil
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rresender/csta-integration/cti/config"
+	"github.com/rresender/csta-integration/cti/db"
+	"github.com/rresender/csta-integration/cti/helper"
+	"github.com/rresender/csta-integration/cti/logger"
+	"github.com/rresender/csta-integration/cti/metrics"
+	"github.com/rresender/csta-integration/cti/provider"
+	"github.com/rresender/csta-integration/cti/rabbitmq"
+
+	xj "github.com/basgys/goxml2json"
+)
+
+const (
+	// responseTimeout waiting for the response of a request
+	responseTimeout = 30 * time.Second
+	// responsePollInterval of the responses saved by the handler
+	responsePollInterval = 500 * time.Millisecond
+)
+
+// Switch CTI provider and PBX handled by the service
+type Switch struct {
+	config.SwitchConfig
+
+	appName            string
+	conn               *provider.Connection
+	sessionID          string
+	extensions         map[string]*db.Extension
+	routeRegistrations map[string]string
+	active             bool
+	leading            bool
+	restarting         bool
+	stop               chan struct{}
+	done               chan struct{}
+	session            sessionState
+	log                *logger.Logger
+	lock               sync.Mutex
+}
+
+func (s *Switch) init(appName string) {
+	s.appName = appName + "-" + s.Name
+	s.log = log.With("switch", s.Name)
+	s.done = make(chan struct{})
+	if s.SessionDuration <= 0 {
+		s.SessionDuration = defaultSessionDuration
+	}
+	if s.SessionCleanupDelay <= 0 {
+		s.SessionCleanupDelay = defaultSessionCleanupDelay
+	}
+	s.extensions = make(map[string]*db.Extension)
+	for _, e := range s.Extensions {
+		s.extensions[e.ID] = &db.Extension{ID: e.ID, Type: strings.ToUpper(e.Type), Switch: s.Name}
+	}
+}
+
+func (s *Switch) getExtensions() []*db.Extension {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	extensions := make([]*db.Extension, 0, len(s.extensions))
+	for _, ext := range s.extensions {
+		extensions = append(extensions, ext)
+	}
+	return extensions
+}
+
+func (s *Switch) setExtension(ext *db.Extension) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.extensions[ext.ID] = ext
+	s.updateMonitorsMetric()
+}
+
+func (s *Switch) removeExtension(ID string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.extensions, ID)
+	s.updateMonitorsMetric()
+}
+
+func (s *Switch) clearExtensions() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.extensions = make(map[string]*db.Extension)
+	s.updateMonitorsMetric()
+}
+
+// updateMonitorsMetric counts the started monitors by type, the lock must be held
+func (s *Switch) updateMonitorsMetric() {
+	monitors := map[string]float64{"VDN": 0, "SKILL": 0}
+	for _, ext := range s.extensions {
+		if ext.MonitorCrossRefID != "" {
+			monitors[ext.Type]++
+		}
+	}
+	for extType, count := range monitors {
+		metrics.ActiveMonitors.WithLabelValues(s.Name, extType).Set(count)
+	}
+}
+
+func (s *Switch) isActive() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.active
+}
+
+// Handler event listener of a switch
+type Handler struct {
+	sw *Switch
+}
+
+// DoProcess process responses from provider_host
+func (h Handler) DoProcess(invokeID string, data string) {
+	name := provider.MessageName(data)
+	switch name {
+	case "RouteRequest", "ReRoute":
+		go h.sw.route(data)
+		return
+	case "RouteEnd":
+		go h.sw.routeEnded(data)
+		return
+	}
+	switch invokeID {
+	case UnsolicitedInvokeID:
+		h.sw.notifyWatchers(name, data)
+		if name == "DigitsGeneratedEvent" || name == "EnteredDigitsEvent" {
+			h.sw.publishDigitsEvent(name, data)
+			return
+		}
+		converted, _ := xj.Convert(bytes.NewBufferString(data))
+		var in map[string]interface{}
+		json.Unmarshal(converted.Bytes(), &in)
+		out := make(map[string]string)
+		helper.ParseJSON(in, out)
+		monitorCrossRefID := out["monitorCrossRefID"]
+		queue := db.Find(helper.GetMonitorCrossRefIDKey(monitorCrossRefID, h.sw.appName))
+		if queue == "" {
+			h.sw.log.Warn("event of an unknown monitor has been dropped", "event", name, "monitorCrossRefID", monitorCrossRefID)
+			return
+		}
+		rabbitmq.Send(helper.GetExchangeName(h.sw.Name, queue), converted)
+	default:
+		if name == "StopApplicationSession" {
+			go h.sw.providerStoppedSession(invokeID, data)
+			return
+		}
+		db.SaveWithTTL(helper.GetInvokeIDKey(invokeID, h.sw.appName), data)
+	}
+}
+
+// ConnectionLost restarts the session of the switch
+func (h Handler) ConnectionLost(err error) {
+	go h.sw.restart(fmt.Sprintf("connection lost: %v", err))
+}
+
+func (s *Switch) readResponse(invokeID string) (string, error) {
+	responseDataReceivedTicker := time.NewTicker(responsePollInterval)
+	defer responseDataReceivedTicker.Stop()
+	timeout := time.After(responseTimeout)
+	for {
+		select {
+		case <-responseDataReceivedTicker.C:
+			data := db.Find(helper.GetInvokeIDKey(invokeID, s.appName))
+			if data == "" {
+				continue
+			}
+			return data, nil
+		case <-timeout:
+			return "", fmt.Errorf("%w for invokeID %s from %s after %v", errResponseTimeout, invokeID, s.Name, responseTimeout)
+		}
+	}
+}
+
+// request sends the message and parses its response
+func (s *Switch) request(queueID string, message string, response interface{}) (err error) {
+	start := time.Now()
+	defer func() {
+		metrics.RequestDuration.WithLabelValues(s.Name, provider.MessageName(message), metrics.Result(err)).Observe(time.Since(start).Seconds())
+	}()
+	_, data, err := s.exchange(queueID, message)
+	if err != nil {
+		return err
+	}
+	return provider.ParseMessageResponse(data, response)
+}
+
+// exchange sends the message with a new invokeID and returns its raw response
+func (s *Switch) exchange(queueID string, message string) (string, string, error) {
+	invokeID := db.GetInvoke(queueID, s.appName)
+	conn, err := s.connection()
+	if err != nil {
+		return invokeID, "", err
+	}
+	if err := conn.Send(invokeID, message); err != nil {
+		return invokeID, "", fmt.Errorf("%w: %v", errNotConnected, err)
+	}
+	data, err := s.readResponse(invokeID)
+	return invokeID, data, err
+}
+
+func (s *Switch) stopMonitoring(extension string) (*db.Extension, error) {
+	ext := db.FindExtension(s.Name, extension)
+	if ext == nil {
+		return nil, errNotMonitored
+	}
+
+	var response provider.MonitorStopResponse
+	err := s.request(extension, provider.MonitorStopMessage(ext.MonitorCrossRefID), &response)
+	if err != nil {
+		s.log.Error("monitor could not be stopped", "extension", extension, "monitorCrossRefID", ext.MonitorCrossRefID, "error", err)
+	}
+
+	db.RemoveExtensionFromList(s.Name, extension)
+	db.DeleteExtension(s.Name, extension)
+	db.Delete(helper.GetMonitorCrossRefIDKey(ext.MonitorCrossRefID, s.appName))
+	s.removeExtension(ext.ID)
+	return ext, err
+}
+
+// releaseMonitor stops the monitor of this session, keeping the record of a new owner
+func (s *Switch) releaseMonitor(ext *db.Extension) {
+	var response provider.MonitorStopResponse
+	if err := s.request(ext.ID, provider.MonitorStopMessage(ext.MonitorCrossRefID), &response); err != nil {
+		s.log.Error("monitor could not be released", "extension", ext.ID, "monitorCrossRefID", ext.MonitorCrossRefID, "error", err)
+	}
+
+	if current := db.FindExtension(s.Name, ext.ID); current != nil && current.Owner == instanceID {
+		db.RemoveExtensionFromList(s.Name, ext.ID)
+		db.DeleteExtension(s.Name, ext.ID)
+	}
+	db.Delete(helper.GetMonitorCrossRefIDKey(ext.MonitorCrossRefID, s.appName))
+	s.removeExtension(ext.ID)
+}
+
+func (s *Switch) getDeviceID(extension string) (string, error) {
+
+	var response provider.GetDeviceIDResponse
+	if err := s.request(extension, provider.GetDeviceIDMessage(s.PBX, extension), &response); err != nil {
+		return "", err
+	}
+	s.log.Debug("device ID", "extension", extension, "deviceID", response.Device.ID)
+
+	return response.Device.ID, nil
+}
+
+func (s *Switch) getMonitorCrossRefID(extension string, message string) (string, error) {
+
+	var response provider.MonitorStartResponse
+	if err := s.request(extension, message, &response); err != nil {
+		return "", err
+	}
+	s.log.Debug("monitor started", "extension", extension, "monitorCrossRefID", response.MonitorCrossRefID)
+
+	db.Save(helper.GetMonitorCrossRefIDKey(response.MonitorCrossRefID, s.appName), extension)
+	return response.MonitorCrossRefID, nil
+}
+
+func (s *Switch) startVDNMonitoring(extension string) (*db.Extension, error) {
+	deviceID, err := s.getDeviceID(extension)
+	if err != nil {
+		return nil, err
+	}
+	monitorCrossRefID, err := s.getMonitorCrossRefID(extension, provider.MonitorVDNStartMessage(deviceID, s.monitoredEvents(extension)))
+	return &db.Extension{ID: extension, Type: "VDN", Switch: s.Name, Owner: instanceID, DeviceID: deviceID, MonitorCrossRefID: monitorCrossRefID}, err
+}
+
+// monitoredEvents of an extension of the configuration, all of them by default
+func (s *Switch) monitoredEvents(extension string) []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, e := range s.Extensions {
+		if e.ID == extension {
+			return e.Events
+		}
+	}
+	return nil
+}
+
+func (s *Switch) startSkillMonitoring(extension string) (*db.Extension, error) {
+	deviceID, err := s.getDeviceID(extension)
+	if err != nil {
+		return nil, err
+	}
+	monitorCrossRefID, err := s.getMonitorCrossRefID(extension, provider.MonitorSkillStartMessage(deviceID))
+	return &db.Extension{ID: extension, Type: "SKILL", Switch: s.Name, Owner: instanceID, DeviceID: deviceID, MonitorCrossRefID: monitorCrossRefID}, err
+}
+
+// doMonitoring starts the monitor of the extension, the record of a previous monitor is kept
+// until the new one has started so that a failure is retried by the next reconciliation
+func (s *Switch) doMonitoring(extension string, extType string) (*db.Extension, error) {
+	previous := db.FindExtension(s.Name, extension)
+	owned := previous != nil && (previous.Owner == "" || previous.Owner == instanceID)
+	switch {
+	case owned:
+		s.log.Info("extension is already being monitored, the monitoring will be restarted", "extension", extension)
+		var response provider.MonitorStopResponse
+		if err := s.request(extension, provider.MonitorStopMessage(previous.MonitorCrossRefID), &response); err != nil {
+			s.log.Warn("previous monitor could not be stopped", "extension", extension, "monitorCrossRefID", previous.MonitorCrossRefID, "error", err)
+		}
+		s.removeExtension(extension)
+	case previous != nil:
+		s.log.Info("extension was monitored by another instance, the monitoring will be taken over", "extension", extension, "owner", previous.Owner)
+	}
+	var ext *db.Extension
+	var err error
+	extType = strings.ToUpper(extType)
+	switch extType {
+	case "VDN":
+		ext, err = s.startVDNMonitoring(extension)
+	case "SKILL":
+		ext, err = s.startSkillMonitoring(extension)
+	default:
+		err = invalidRequest(fmt.Errorf("type %s is not valid", extType))
+	}
+	if err == nil {
+		if owned && previous.MonitorCrossRefID != "" && previous.MonitorCrossRefID != ext.MonitorCrossRefID {
+			db.Delete(helper.GetMonitorCrossRefIDKey(previous.MonitorCrossRefID, s.appName))
+		}
+		db.AddExtensionToList(s.Name, ext.ID)
+		db.SaveExtension(ext)
+		s.setExtension(ext)
+		if ext.Type == "VDN" {
+			s.publishSnapshot(ext)
+		}
+	}
+	return ext, err
+}
+
+func (s *Switch) cleanUp() {
+	if !s.isActive() {
+		return
+	}
+
+	for _, extension := range s.getExtensions() {
+		s.stopMonitoring(extension.ID)
+	}
+
+	s.shutdown()
+}
@@ -0,0 +1,265 @@
+package uui
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Format of the user-to-user information
+type Format int
+
+const (
+	// Plain printable text, optionally key=value pairs separated by ';'
+	Plain Format = iota
+	// Hex binary data which is not printable
+	Hex
+	// Shared ASAI shared UUI: a list of ID, length and value elements
+	Shared
+)
+
+func (f Format) String() string {
+	switch f {
+	case Plain:
+		return "plain"
+	case Hex:
+		return "hex"
+	case Shared:
+		return "shared"
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// ParseFormat by its name, plain when the name is empty
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "plain":
+		return Plain, nil
+	case "hex":
+		return Hex, nil
+	case "shared":
+		return Shared, nil
+	}
+	return Plain, fmt.Errorf("uui format %q must be plain, hex or shared", name)
+}
+
+// ID of a shared UUI element
+type ID byte
+
+const (
+	// UCID element carrying the universal call ID
+	UCID ID = 0xC8
+	// UserData element carrying the application user data
+	UserData ID = 0xFA
+)
+
+// MaxLength of the user-to-user information accepted by the switch
+const MaxLength = 96
+
+var idNames = map[ID]string{
+	UCID:     "UCID",
+	UserData: "UserData",
+}
+
+// Name of the element, its hex value when unknown
+func (id ID) Name() string {
+	if name, ok := idNames[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("%02X", byte(id))
+}
+
+// Field element of a shared UUI
+type Field struct {
+	ID    ID
+	Value []byte
+}
+
+// UUI user-to-user information
+type UUI struct {
+	Format Format
+	Data   []byte
+	Fields []Field
+}
+
+// ErrTooLong the encoded UUI exceeds MaxLength
+var ErrTooLong = fmt.Errorf("uui exceeds %d bytes", MaxLength)
+
+// NewPlain UUI from text
+func NewPlain(text string) *UUI {
+	return &UUI{Format: Plain, Data: []byte(text)}
+}
+
+// NewKeyValue plain UUI from key=value pairs in the given key order
+func NewKeyValue(keys []string, values map[string]string) *UUI {
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+values[k])
+	}
+	return NewPlain(strings.Join(pairs, ";"))
+}
+
+// MaxFieldLength of a shared UUI element value, its length is encoded in a single byte
+const MaxFieldLength = 255
+
+// NewShared UUI from its elements
+func NewShared(fields ...Field) (*UUI, error) {
+	var data bytes.Buffer
+	for _, f := range fields {
+		if len(f.Value) > MaxFieldLength {
+			return nil, fmt.Errorf("shared uui element %s exceeds %d bytes", f.ID.Name(), MaxFieldLength)
+		}
+		data.WriteByte(byte(f.ID))
+		data.WriteByte(byte(len(f.Value)))
+		data.Write(f.Value)
+	}
+	return &UUI{Format: Shared, Data: data.Bytes(), Fields: fields}, nil
+}
+
+// NewHex UUI from the hex digits of binary data
+func NewHex(hexData string) (*UUI, error) {
+	data, err := hex.DecodeString(strings.TrimSpace(hexData))
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex uui: %v", err)
+	}
+	return &UUI{Format: Hex, Data: data}, nil
+}
+
+// New UUI of the format from text: the text itself when plain, its hex digits when hex
+// and the UserData element when shared
+func New(format Format, text string) (*UUI, error) {
+	switch format {
+	case Plain:
+		return NewPlain(text), nil
+	case Hex:
+		return NewHex(text)
+	case Shared:
+		return NewShared(Field{ID: UserData, Value: []byte(text)})
+	}
+	return nil, fmt.Errorf("uui format %v is not supported", format)
+}
+
+// ParseShared elements from binary data
+func ParseShared(data []byte) ([]Field, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty shared uui")
+	}
+	var fields []Field
+	for i := 0; i < len(data); {
+		if i+2 > len(data) {
+			return nil, fmt.Errorf("truncated shared uui element at %d", i)
+		}
+		id, length := ID(data[i]), int(data[i+1])
+		if id < 0x80 {
+			return nil, fmt.Errorf("invalid shared uui element ID %02X at %d", byte(id), i)
+		}
+		i += 2
+		if i+length > len(data) {
+			return nil, fmt.Errorf("shared uui element %s exceeds data length", id.Name())
+		}
+		fields = append(fields, Field{ID: id, Value: data[i : i+length]})
+		i += length
+	}
+	return fields, nil
+}
+
+// Parse binary data detecting its format
+func Parse(data []byte) *UUI {
+	if fields, err := ParseShared(data); err == nil {
+		return &UUI{Format: Shared, Data: data, Fields: fields}
+	}
+	if printable(data) {
+		return &UUI{Format: Plain, Data: data}
+	}
+	return &UUI{Format: Hex, Data: data}
+}
+
+// Decode the hex encoded user data of a CSTA event
+func Decode(hexData string) (*UUI, error) {
+	data, err := hex.DecodeString(strings.TrimSpace(hexData))
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex uui: %v", err)
+	}
+	return Parse(data), nil
+}
+
+// Encode to the hex representation used by CSTA userData
+func (u *UUI) Encode() (string, error) {
+	if len(u.Data) > MaxLength {
+		return "", ErrTooLong
+	}
+	return strings.ToUpper(hex.EncodeToString(u.Data)), nil
+}
+
+// Field value by ID
+func (u *UUI) Field(id ID) ([]byte, bool) {
+	for _, f := range u.Fields {
+		if f.ID == id {
+			return f.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Text representation of the UUI
+func (u *UUI) Text() string {
+	switch u.Format {
+	case Plain:
+		return string(u.Data)
+	case Shared:
+		if v, ok := u.Field(UserData); ok && printable(v) {
+			return string(v)
+		}
+	}
+	return strings.ToUpper(hex.EncodeToString(u.Data))
+}
+
+// Values of the UUI: shared elements by name or plain key=value pairs
+func (u *UUI) Values() map[string]string {
+	values := make(map[string]string)
+	switch u.Format {
+	case Shared:
+		for _, f := range u.Fields {
+			if printable(f.Value) {
+				values[f.ID.Name()] = string(f.Value)
+			} else {
+				values[f.ID.Name()] = strings.ToUpper(hex.EncodeToString(f.Value))
+			}
+		}
+		if v, ok := u.Field(UserData); ok && printable(v) {
+			for k, v := range parsePairs(string(v)) {
+				values[k] = v
+			}
+		}
+	case Plain:
+		values = parsePairs(string(u.Data))
+	}
+	return values
+}
+
+func parsePairs(text string) map[string]string {
+	values := make(map[string]string)
+	for _, pair := range strings.Split(text, ";") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			continue
+		}
+		values[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return values
+}
+
+func printable(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+	for _, r := range string(data) {
+		if r == unicode.ReplacementChar || !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
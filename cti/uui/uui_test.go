@@ -0,0 +1,194 @@
+package uui
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestNewShared(t *testing.T) {
+	tests := []struct {
+		name    string
+		fields  []Field
+		data    []byte
+		wantErr bool
+	}{
+		{"ucid", []Field{{UCID, []byte{0x01, 0x02}}}, []byte{0xC8, 0x02, 0x01, 0x02}, false},
+		{"empty value", []Field{{UserData, nil}}, []byte{0xFA, 0x00}, false},
+		{"two fields", []Field{{UCID, []byte{0x01}}, {UserData, []byte("a=1")}}, []byte{0xC8, 0x01, 0x01, 0xFA, 0x03, 'a', '=', '1'}, false},
+		{"max length", []Field{{UserData, bytes.Repeat([]byte{'x'}, MaxFieldLength)}}, append([]byte{0xFA, 0xFF}, bytes.Repeat([]byte{'x'}, MaxFieldLength)...), false},
+		{"over max length", []Field{{UserData, bytes.Repeat([]byte{'x'}, MaxFieldLength+1)}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := NewShared(tt.fields...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewShared() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !bytes.Equal(u.Data, tt.data) {
+				t.Errorf("NewShared() data = %X, want %X", u.Data, tt.data)
+			}
+			fields, err := ParseShared(u.Data)
+			if err != nil {
+				t.Fatalf("ParseShared() error = %v", err)
+			}
+			if len(fields) != len(tt.fields) {
+				t.Fatalf("ParseShared() = %d fields, want %d", len(fields), len(tt.fields))
+			}
+			for i, f := range fields {
+				if f.ID != tt.fields[i].ID || !bytes.Equal(f.Value, tt.fields[i].Value) {
+					t.Errorf("ParseShared() field %d = %v, want %v", i, f, tt.fields[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseShared(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{"empty", nil, true},
+		{"truncated element", []byte{0xC8}, true},
+		{"invalid ID", []byte{0x41, 0x01, 0x01}, true},
+		{"value exceeds data", []byte{0xC8, 0x05, 0x01}, true},
+		{"valid", []byte{0xC8, 0x01, 0x01}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseShared(tt.data); (err != nil) != tt.wantErr {
+				t.Errorf("ParseShared() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		hex     string
+		format  Format
+		text    string
+		wantErr bool
+	}{
+		{"plain", "613D313B623D32", Plain, "a=1;b=2", false},
+		{"shared", "C80101FA03613D31", Shared, "a=1", false},
+		{"binary", "0001", Hex, "0001", false},
+		{"spaces", " 6869 ", Plain, "hi", false},
+		{"invalid hex", "ZZ", Plain, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := Decode(tt.hex)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if u.Format != tt.format {
+				t.Errorf("Decode() format = %s, want %s", u.Format, tt.format)
+			}
+			if text := u.Text(); text != tt.text {
+				t.Errorf("Text() = %q, want %q", text, tt.text)
+			}
+		})
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name    string
+		uui     *UUI
+		want    string
+		wantErr error
+	}{
+		{"plain", NewPlain("hi"), "6869", nil},
+		{"key value", NewKeyValue([]string{"b", "a"}, map[string]string{"a": "1", "b": "2"}), "623D323B613D31", nil},
+		{"max length", NewPlain(strings.Repeat("x", MaxLength)), strings.Repeat("78", MaxLength), nil},
+		{"too long", NewPlain(strings.Repeat("x", MaxLength+1)), "", ErrTooLong},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.uui.Encode()
+			if err != tt.wantErr {
+				t.Fatalf("Encode() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Encode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		text    string
+		want    string
+		wantErr bool
+	}{
+		{"plain by default", "", "hi", "6869", false},
+		{"plain", "plain", "a=1", "613D31", false},
+		{"hex", "HEX", "c8 01", "", true},
+		{"hex digits", "hex", "c801ff", "C801FF", false},
+		{"shared user data", "shared", "hi", "FA026869", false},
+		{"shared element too long", "shared", strings.Repeat("x", MaxFieldLength+1), "", true},
+		{"unknown format", "asai", "hi", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, err := ParseFormat(tt.format)
+			var u *UUI
+			if err == nil {
+				u, err = New(format, tt.text)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			got, err := u.Encode()
+			if err != nil || got != tt.want {
+				t.Errorf("Encode() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValues(t *testing.T) {
+	tests := []struct {
+		name string
+		hex  string
+		want map[string]string
+	}{
+		{"plain pairs", "613D31203B20623D32", map[string]string{"a": "1", "b": "2"}},
+		{"plain without pairs", "6869", map[string]string{}},
+		{"shared", "C80201FFFA03613D31", map[string]string{"UCID": "01FF", "UserData": "a=1", "a": "1"}},
+		{"unknown element", "9001AB", map[string]string{"90": "AB"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := Decode(tt.hex)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			got := u.Values()
+			if len(got) != len(tt.want) {
+				t.Fatalf("Values() = %v, want %v", got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("Values()[%s] = %q, want %q", k, got[k], v)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,383 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// Call Object
+type Call struct {
+	UCID         string
+	UUI          string
+	UUIFields    map[string]string
+	AgentStation string
+	AgentID      string
+	Skill        string
+	VDN          string
+	ANI          string
+	StartTime    time.Time
+	Agents       []string
+	Legs         []CallLeg
+	LinkedUCIDs  []string
+}
+
+// CallLeg participation of a device in a call
+type CallLeg struct {
+	UCID         string
+	Event        string
+	AgentID      string
+	AgentStation string
+	Time         time.Time
+}
+
+// AddAgent to the agents involved in the call
+func (c *Call) AddAgent(agentID string) {
+	if agentID != "" {
+		c.Agents = AppendUnique(c.Agents, agentID)
+	}
+}
+
+// Link the call to other UCIDs
+func (c *Call) Link(UCIDs ...string) {
+	for _, UCID := range UCIDs {
+		if UCID != "" && UCID != c.UCID {
+			c.LinkedUCIDs = AppendUnique(c.LinkedUCIDs, UCID)
+		}
+	}
+}
+
+// HasLeg the call already has the leg
+func (c *Call) HasLeg(leg CallLeg) bool {
+	for _, l := range c.Legs {
+		if l.UCID == leg.UCID && l.Event == leg.Event && l.AgentStation == leg.AgentStation && l.Time.Equal(leg.Time) {
+			return true
+		}
+	}
+	return false
+}
+
+// TransferUCIDs of the calls of a transfer or a conference: the resulting call, the primary old call when the
+// resulting one is not reported, and every known call, resulting first, empty when none of them is known
+func TransferUCIDs(resulting string, primary string, secondary string) (string, []string) {
+	if resulting == "" {
+		resulting = primary
+	}
+	UCIDs := []string{}
+	if resulting == "" {
+		return "", UCIDs
+	}
+	for _, UCID := range []string{resulting, primary, secondary} {
+		if UCID != "" {
+			UCIDs = AppendUnique(UCIDs, UCID)
+		}
+	}
+	return resulting, UCIDs
+}
+
+// MergeCalls links the calls to each other and merges the caller, the earliest start, the agents and
+// the legs of the other calls into the resulting one
+func MergeCalls(result *Call, calls []*Call) {
+	UCIDs := []string{}
+	for _, call := range calls {
+		UCIDs = AppendUnique(UCIDs, call.UCID)
+	}
+	for _, call := range calls {
+		call.Link(UCIDs...)
+		if call == result {
+			continue
+		}
+		if result.ANI == "" {
+			result.ANI = call.ANI
+			result.VDN = call.VDN
+		}
+		if call.StartTime.Before(result.StartTime) {
+			result.StartTime = call.StartTime
+		}
+		for _, agent := range call.Agents {
+			result.AddAgent(agent)
+		}
+		for _, leg := range call.Legs {
+			if !result.HasLeg(leg) {
+				result.Legs = append(result.Legs, leg)
+			}
+		}
+	}
+}
+
+// AppendUnique appends the value when it is not already present
+func AppendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+// CallQuery search criteria for the call history
+type CallQuery struct {
+	ANI     string
+	AgentID string
+	VDN     string
+	Skill   string
+	UUI     string
+	From    time.Time
+	To      time.Time
+	Offset  int
+	Limit   int
+}
+
+// CallPage a page of the call history, Truncated when a search filtering the UUI stopped reading
+// after MaxUUISearchScan calls while the history has more of them
+type CallPage struct {
+	Total     int
+	Offset    int
+	Limit     int
+	Truncated bool
+	Calls     []Call
+}
+
+// DefaultCallPageLimit used when the query does not provide a limit
+const DefaultCallPageLimit = 50
+
+// MaxUUISearchScan calls read by a search filtering the UUI, its total counts only the calls read
+// and its page is Truncated when there are more
+const MaxUUISearchScan = 10000
+
+// callSearchBatch calls read at once by a search filtering the UUI
+const callSearchBatch = 500
+
+// maxPageReads of a search without UUI, the page is read again after the expired calls are pruned
+const maxPageReads = 3
+
+// CallRetention of the calls and of the history indexes, the calls expire after it and the
+// older index entries are trimmed when a call is indexed
+var CallRetention = 90 * 24 * time.Hour
+
+const callsIndex = "calls"
+
+func getCallIndexKey(field string, value string) string {
+	return callsIndex + "-" + field + "-" + value
+}
+
+// callIndexKeys of the fields that are set
+func callIndexKeys(ANI string, agentID string, VDN string, skill string) []string {
+	keys := []string{}
+	for _, field := range []struct{ name, value string }{
+		{"ani", ANI},
+		{"agent", agentID},
+		{"vdn", VDN},
+		{"skill", skill},
+	} {
+		if field.value != "" {
+			keys = append(keys, getCallIndexKey(field.name, field.value))
+		}
+	}
+	return keys
+}
+
+// IndexCall adds the call to the history indexes
+func IndexCall(conn *redis.Client, call *Call) error {
+	if call.UCID == "" {
+		return fmt.Errorf("call without UCID can not be indexed")
+	}
+	z := redis.Z{Score: float64(call.StartTime.Unix()), Member: call.UCID}
+	keys := append([]string{callsIndex}, callIndexKeys(call.ANI, call.AgentID, call.VDN, call.Skill)...)
+	cutoff := "(" + strconv.FormatInt(time.Now().Add(-CallRetention).Unix(), 10)
+	pipe := conn.TxPipeline()
+	for _, key := range keys {
+		pipe.ZAdd(key, z)
+		pipe.ZRemRangeByScore(key, "-inf", cutoff)
+		pipe.Expire(key, CallRetention)
+	}
+	_, err := pipe.Exec()
+	return err
+}
+
+// FindCall by UCID
+func FindCall(conn *redis.Client, UCID string) (*Call, error) {
+	v, err := conn.Get(UCID).Bytes()
+	if err != nil {
+		return nil, err
+	}
+	var call Call
+	if err := json.Unmarshal(v, &call); err != nil {
+		return nil, err
+	}
+	return &call, nil
+}
+
+// scoreRange of the start times of the query, unbounded without From and To
+func (q CallQuery) scoreRange() redis.ZRangeBy {
+	rangeBy := redis.ZRangeBy{Min: "-inf", Max: "+inf"}
+	if !q.From.IsZero() {
+		rangeBy.Min = strconv.FormatInt(q.From.Unix(), 10)
+	}
+	if !q.To.IsZero() {
+		rangeBy.Max = strconv.FormatInt(q.To.Unix(), 10)
+	}
+	return rangeBy
+}
+
+// page of the query with the default limit and a positive offset
+func (q CallQuery) page() *CallPage {
+	page := &CallPage{Offset: q.Offset, Limit: q.Limit, Calls: []Call{}}
+	if page.Limit <= 0 {
+		page.Limit = DefaultCallPageLimit
+	}
+	if page.Offset < 0 {
+		page.Offset = 0
+	}
+	return page
+}
+
+// addMatching calls of the UUI to the page, counting every match in its total
+func (p *CallPage) addMatching(calls []Call, UUI string) {
+	for _, call := range calls {
+		if !strings.Contains(call.UUI, UUI) {
+			continue
+		}
+		if p.Total >= p.Offset && len(p.Calls) < p.Limit {
+			p.Calls = append(p.Calls, call)
+		}
+		p.Total++
+	}
+}
+
+// SearchCalls in the history, newest first, reading only the page of the query unless the UUI is filtered
+func SearchCalls(conn *redis.Client, query CallQuery) (*CallPage, error) {
+	keys := callIndexKeys(query.ANI, query.AgentID, query.VDN, query.Skill)
+
+	// the expired calls are pruned from every index read by the search
+	indexes := append([]string{callsIndex}, keys...)
+	index := callsIndex
+	switch len(keys) {
+	case 0:
+	case 1:
+		index = keys[0]
+	default:
+		index = fmt.Sprintf("%s-search-%d", callsIndex, time.Now().UnixNano())
+		pipe := conn.TxPipeline()
+		pipe.ZInterStore(index, redis.ZStore{Aggregate: "MAX"}, keys...)
+		pipe.Expire(index, 30*time.Second)
+		if _, err := pipe.Exec(); err != nil {
+			return nil, err
+		}
+		defer conn.Del(index)
+		indexes = append(indexes, index)
+	}
+
+	rangeBy := query.scoreRange()
+	page := query.page()
+
+	if query.UUI == "" {
+		// the total counts the expired calls until they are pruned, the page is then read again
+		for reads := 1; ; reads++ {
+			total, err := conn.ZCount(index, rangeBy.Min, rangeBy.Max).Result()
+			if err != nil {
+				return nil, err
+			}
+			page.Total = int(total)
+			rangeBy.Offset, rangeBy.Count = int64(page.Offset), int64(page.Limit)
+			UCIDs, err := conn.ZRevRangeByScore(index, rangeBy).Result()
+			if err != nil {
+				return nil, err
+			}
+			var expired []string
+			page.Calls, expired, err = findCalls(conn, UCIDs)
+			if err != nil || len(expired) == 0 {
+				return page, err
+			}
+			if err := pruneCalls(conn, indexes, expired); err != nil {
+				return nil, err
+			}
+			if reads == maxPageReads {
+				page.Total -= len(expired)
+				return page, nil
+			}
+		}
+	}
+
+	// the UUI is not indexed: the calls are filtered in batches, up to MaxUUISearchScan calls,
+	// the expired calls are pruned once the scan is over so that the batches are not shifted
+	var expired []string
+	for scanned := 0; ; scanned += callSearchBatch {
+		if scanned >= MaxUUISearchScan {
+			rangeBy.Offset, rangeBy.Count = int64(scanned), 1
+			more, err := conn.ZRevRangeByScore(index, rangeBy).Result()
+			if err != nil {
+				return nil, err
+			}
+			page.Truncated = len(more) > 0
+			break
+		}
+		rangeBy.Offset, rangeBy.Count = int64(scanned), callSearchBatch
+		UCIDs, err := conn.ZRevRangeByScore(index, rangeBy).Result()
+		if err != nil {
+			return nil, err
+		}
+		calls, missing, err := findCalls(conn, UCIDs)
+		if err != nil {
+			return nil, err
+		}
+		expired = append(expired, missing...)
+		page.addMatching(calls, query.UUI)
+		if len(UCIDs) < callSearchBatch {
+			break
+		}
+	}
+	if err := pruneCalls(conn, indexes, expired); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// pruneCalls removes the UCIDs of the expired calls from the indexes
+func pruneCalls(conn *redis.Client, indexes []string, UCIDs []string) error {
+	if len(UCIDs) == 0 {
+		return nil
+	}
+	members := make([]interface{}, len(UCIDs))
+	for i, UCID := range UCIDs {
+		members[i] = UCID
+	}
+	pipe := conn.TxPipeline()
+	for _, index := range indexes {
+		pipe.ZRem(index, members...)
+	}
+	_, err := pipe.Exec()
+	return err
+}
+
+// findCalls by UCID, returning apart the UCIDs of the calls no longer stored
+func findCalls(conn *redis.Client, UCIDs []string) ([]Call, []string, error) {
+	calls := []Call{}
+	if len(UCIDs) == 0 {
+		return calls, nil, nil
+	}
+	values, err := conn.MGet(UCIDs...).Result()
+	if err != nil {
+		return nil, nil, err
+	}
+	var expired []string
+	for i, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			expired = append(expired, UCIDs[i])
+			continue
+		}
+		var call Call
+		if err := json.Unmarshal([]byte(s), &call); err != nil {
+			log.Printf("error while unmarshaling call %s: %v\n", UCIDs[i], err)
+			continue
+		}
+		calls = append(calls, call)
+	}
+	return calls, expired, nil
+}
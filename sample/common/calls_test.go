@@ -0,0 +1,190 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCallLink(t *testing.T) {
+	tests := []struct {
+		name  string
+		UCIDs []string
+		want  []string
+	}{
+		{"linked", []string{"2"}, []string{"2"}},
+		{"unique", []string{"2", "3", "2"}, []string{"2", "3"}},
+		{"not to itself", []string{"1", "2"}, []string{"2"}},
+		{"empty UCID", []string{""}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Call{UCID: "1"}
+			c.Link(tt.UCIDs...)
+			if !reflect.DeepEqual(c.LinkedUCIDs, tt.want) {
+				t.Errorf("Link(%v) = %v, want %v", tt.UCIDs, c.LinkedUCIDs, tt.want)
+			}
+		})
+	}
+}
+
+func TestCallAddAgent(t *testing.T) {
+	c := &Call{UCID: "1"}
+	for _, agentID := range []string{"100", "", "101", "100"} {
+		c.AddAgent(agentID)
+	}
+	if want := []string{"100", "101"}; !reflect.DeepEqual(c.Agents, want) {
+		t.Errorf("AddAgent() agents = %v, want %v", c.Agents, want)
+	}
+}
+
+func TestCallIndexKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		ANI     string
+		agentID string
+		VDN     string
+		skill   string
+		want    []string
+	}{
+		{"none", "", "", "", "", []string{}},
+		{"ani", "5551000", "", "", "", []string{"calls-ani-5551000"}},
+		{"every field", "5551000", "100", "5000", "10", []string{"calls-ani-5551000", "calls-agent-100", "calls-vdn-5000", "calls-skill-10"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := callIndexKeys(tt.ANI, tt.agentID, tt.VDN, tt.skill); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("callIndexKeys() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCallQueryScoreRange(t *testing.T) {
+	from, to := time.Unix(1700000000, 0), time.Unix(1700003600, 0)
+	tests := []struct {
+		name  string
+		query CallQuery
+		min   string
+		max   string
+	}{
+		{"unbounded", CallQuery{}, "-inf", "+inf"},
+		{"from", CallQuery{From: from}, "1700000000", "+inf"},
+		{"to", CallQuery{To: to}, "-inf", "1700003600"},
+		{"from and to", CallQuery{From: from, To: to}, "1700000000", "1700003600"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.query.scoreRange()
+			if got.Min != tt.min || got.Max != tt.max {
+				t.Errorf("scoreRange() = [%s, %s], want [%s, %s]", got.Min, got.Max, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestCallQueryPage(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  CallQuery
+		offset int
+		limit  int
+	}{
+		{"defaults", CallQuery{}, 0, DefaultCallPageLimit},
+		{"page", CallQuery{Offset: 20, Limit: 10}, 20, 10},
+		{"negative", CallQuery{Offset: -1, Limit: -1}, 0, DefaultCallPageLimit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.query.page()
+			if got.Offset != tt.offset || got.Limit != tt.limit || got.Calls == nil {
+				t.Errorf("page() = %+v, want offset %d and limit %d", got, tt.offset, tt.limit)
+			}
+		})
+	}
+}
+
+func TestCallPageAddMatching(t *testing.T) {
+	batches := [][]Call{
+		{{UCID: "1", UUI: "order=1"}, {UCID: "2", UUI: "other"}, {UCID: "3", UUI: "order=3"}},
+		{{UCID: "4", UUI: "order=4"}, {UCID: "5", UUI: "order=5"}},
+	}
+	tests := []struct {
+		name   string
+		offset int
+		limit  int
+		UCIDs  []string
+	}{
+		{"first page", 0, 2, []string{"1", "3"}},
+		{"across the batches", 1, 2, []string{"3", "4"}},
+		{"last page", 3, 2, []string{"5"}},
+		{"after the matches", 4, 2, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := CallQuery{Offset: tt.offset, Limit: tt.limit}.page()
+			for _, calls := range batches {
+				page.addMatching(calls, "order=")
+			}
+			var UCIDs []string
+			for _, call := range page.Calls {
+				UCIDs = append(UCIDs, call.UCID)
+			}
+			if !reflect.DeepEqual(UCIDs, tt.UCIDs) || page.Total != 4 {
+				t.Errorf("addMatching() = %v of %d, want %v of 4", UCIDs, page.Total, tt.UCIDs)
+			}
+		})
+	}
+}
+
+func TestTransferUCIDs(t *testing.T) {
+	tests := []struct {
+		name                          string
+		resulting, primary, secondary string
+		wantResulting                 string
+		wantUCIDs                     []string
+	}{
+		{"all known", "3", "1", "2", "3", []string{"3", "1", "2"}},
+		{"resulting not reported", "", "1", "2", "1", []string{"1", "2"}},
+		{"secondary unknown", "3", "1", "", "3", []string{"3", "1"}},
+		{"resulting is primary", "1", "1", "2", "1", []string{"1", "2"}},
+		{"none known", "", "", "2", "", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resulting, UCIDs := TransferUCIDs(tt.resulting, tt.primary, tt.secondary)
+			if resulting != tt.wantResulting || !reflect.DeepEqual(UCIDs, tt.wantUCIDs) {
+				t.Errorf("TransferUCIDs() = %q, %v, want %q, %v", resulting, UCIDs, tt.wantResulting, tt.wantUCIDs)
+			}
+		})
+	}
+}
+
+func TestMergeCalls(t *testing.T) {
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	shared := CallLeg{UCID: "1", Event: "Established", AgentStation: "2001", Time: start}
+	result := &Call{UCID: "3", StartTime: start.Add(time.Minute), Agents: []string{"100"}, Legs: []CallLeg{shared}}
+	primary := &Call{UCID: "1", ANI: "0600", VDN: "5000", StartTime: start, Agents: []string{"100", "101"},
+		Legs: []CallLeg{shared, {UCID: "1", Event: "Delivered", AgentStation: "2002", Time: start}}}
+	secondary := &Call{UCID: "2", ANI: "0700", VDN: "5001", StartTime: start.Add(2 * time.Minute), Agents: []string{"102"}}
+
+	MergeCalls(result, []*Call{result, primary, secondary})
+
+	if result.ANI != "0600" || result.VDN != "5000" {
+		t.Errorf("MergeCalls() caller = %q %q, want the primary one", result.ANI, result.VDN)
+	}
+	if !result.StartTime.Equal(start) {
+		t.Errorf("MergeCalls() start = %v, want %v", result.StartTime, start)
+	}
+	if want := []string{"100", "101", "102"}; !reflect.DeepEqual(result.Agents, want) {
+		t.Errorf("MergeCalls() agents = %v, want %v", result.Agents, want)
+	}
+	if len(result.Legs) != 2 {
+		t.Errorf("MergeCalls() legs = %v, want the shared leg once", result.Legs)
+	}
+	for _, call := range []*Call{result, primary, secondary} {
+		if len(call.LinkedUCIDs) != 2 {
+			t.Errorf("MergeCalls() call %s linked to %v, want the two others", call.UCID, call.LinkedUCIDs)
+		}
+	}
+}
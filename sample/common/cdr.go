@@ -0,0 +1,67 @@
+package db
+
+import (
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// CDR call detail record of every linked call
+type CDR struct {
+	UCIDs     []string
+	ANI       string
+	VDN       string
+	StartTime time.Time
+	Agents    []string
+	Legs      []CallLeg
+}
+
+// BuildCDR following the links of the call
+func BuildCDR(conn *redis.Client, UCID string) (*CDR, error) {
+	first, err := FindCall(conn, UCID)
+	if err != nil {
+		return nil, err
+	}
+	return buildCDR(first, func(UCID string) (*Call, error) { return FindCall(conn, UCID) }), nil
+}
+
+// buildCDR walking the links from the first call, the calls that cannot be found are skipped
+func buildCDR(first *Call, find func(UCID string) (*Call, error)) *CDR {
+	cdr := &CDR{ANI: first.ANI, VDN: first.VDN, StartTime: first.StartTime, Agents: []string{}, Legs: []CallLeg{}}
+	legs := make(map[CallLeg]bool)
+	visited := map[string]bool{first.UCID: true}
+	pending := []*Call{first}
+	for len(pending) > 0 {
+		call := pending[0]
+		pending = pending[1:]
+		cdr.UCIDs = append(cdr.UCIDs, call.UCID)
+		if !call.StartTime.IsZero() && call.StartTime.Before(cdr.StartTime) {
+			cdr.StartTime = call.StartTime
+			cdr.ANI = call.ANI
+			cdr.VDN = call.VDN
+		}
+		for _, agent := range call.Agents {
+			cdr.Agents = AppendUnique(cdr.Agents, agent)
+		}
+		for _, leg := range call.Legs {
+			if !legs[leg] {
+				legs[leg] = true
+				cdr.Legs = append(cdr.Legs, leg)
+			}
+		}
+		for _, linked := range call.LinkedUCIDs {
+			if visited[linked] {
+				continue
+			}
+			visited[linked] = true
+			if c, err := find(linked); err == nil {
+				pending = append(pending, c)
+			}
+		}
+	}
+	sort.SliceStable(cdr.Legs, func(i, j int) bool {
+		return cdr.Legs[i].Time.Before(cdr.Legs[j].Time)
+	})
+	return cdr
+}
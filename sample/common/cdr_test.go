@@ -0,0 +1,41 @@
+package db
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBuildCDR(t *testing.T) {
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	leg := CallLeg{UCID: "1", Event: "Delivered", AgentStation: "2001", Time: start.Add(time.Second)}
+	calls := map[string]*Call{
+		"1": {UCID: "1", ANI: "0600", VDN: "5000", StartTime: start, Agents: []string{"100"}, LinkedUCIDs: []string{"2", "4"},
+			Legs: []CallLeg{leg}},
+		"2": {UCID: "2", ANI: "0700", StartTime: start.Add(time.Minute), Agents: []string{"101", "100"}, LinkedUCIDs: []string{"1", "3"},
+			Legs: []CallLeg{leg, {UCID: "2", Event: "Established", AgentStation: "2002", Time: start}}},
+		"3": {UCID: "3", StartTime: start.Add(2 * time.Minute), LinkedUCIDs: []string{"2"}},
+	}
+	find := func(UCID string) (*Call, error) {
+		if call, ok := calls[UCID]; ok {
+			return call, nil
+		}
+		return nil, errors.New("not found")
+	}
+
+	cdr := buildCDR(calls["2"], find)
+
+	if want := []string{"2", "1", "3"}; !reflect.DeepEqual(cdr.UCIDs, want) {
+		t.Errorf("buildCDR() UCIDs = %v, want %v", cdr.UCIDs, want)
+	}
+	if cdr.ANI != "0600" || cdr.VDN != "5000" || !cdr.StartTime.Equal(start) {
+		t.Errorf("buildCDR() caller = %q %q %v, want the earliest call", cdr.ANI, cdr.VDN, cdr.StartTime)
+	}
+	if want := []string{"101", "100"}; !reflect.DeepEqual(cdr.Agents, want) {
+		t.Errorf("buildCDR() agents = %v, want %v", cdr.Agents, want)
+	}
+	if len(cdr.Legs) != 2 || cdr.Legs[0].UCID != "2" {
+		t.Errorf("buildCDR() legs = %v, want two legs sorted by time", cdr.Legs)
+	}
+}
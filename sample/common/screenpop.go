@@ -0,0 +1,65 @@
+package db
+
+import (
+	"encoding/json"
+
+	"github.com/go-redis/redis"
+)
+
+// ScreenPopHistoryLimit prior calls of the same ANI sent with a screen pop
+const ScreenPopHistoryLimit = 10
+
+// ScreenPop pushed to the agent desktop
+type ScreenPop struct {
+	Event   string
+	Station string
+	AgentID string
+	Call    Call
+	History []Call
+}
+
+// GetStationScreenPopChannel pub/sub channel of a station
+func GetStationScreenPopChannel(station string) string {
+	return "screenpop-station-" + station
+}
+
+// GetAgentScreenPopChannel pub/sub channel of an agent
+func GetAgentScreenPopChannel(agentID string) string {
+	return "screenpop-agent-" + agentID
+}
+
+// NewScreenPop enriched with the prior calls of the caller
+func NewScreenPop(conn *redis.Client, event string, station string, call *Call) (*ScreenPop, error) {
+	pop := &ScreenPop{Event: event, Station: station, AgentID: call.AgentID, Call: *call, History: []Call{}}
+	if call.ANI == "" {
+		return pop, nil
+	}
+	page, err := SearchCalls(conn, CallQuery{ANI: call.ANI, Limit: ScreenPopHistoryLimit + 1})
+	if err != nil {
+		return pop, err
+	}
+	for _, c := range page.Calls {
+		if c.UCID != call.UCID && len(pop.History) < ScreenPopHistoryLimit {
+			pop.History = append(pop.History, c)
+		}
+	}
+	return pop, nil
+}
+
+// PublishScreenPop to the station and agent channels
+func PublishScreenPop(conn *redis.Client, pop *ScreenPop) error {
+	value, err := json.Marshal(pop)
+	if err != nil {
+		return err
+	}
+	channels := []string{GetStationScreenPopChannel(pop.Station)}
+	if pop.AgentID != "" {
+		channels = append(channels, GetAgentScreenPopChannel(pop.AgentID))
+	}
+	for _, channel := range channels {
+		if err := conn.Publish(channel, value).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
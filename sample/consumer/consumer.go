@@ -1,23 +1,27 @@
 package main
 
 import (
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
-	"os"
 	"strings"
+	"time"
 
 	"github.com/go-redis/redis"
+	"github.com/rresender/csta-integration/cti/config"
+	"github.com/rresender/csta-integration/cti/helper"
+	"github.com/rresender/csta-integration/cti/uui"
 	db "github.com/rresender/csta-integration/sample/common"
 	"github.com/streadway/amqp"
 	"github.com/tidwall/gjson"
 )
 
 var (
-	conn   *redis.Client
-	mq     *amqp.Connection
-	topics []Topic
+	conn     *redis.Client
+	mq       *amqp.Connection
+	topics   []Topic
+	ctiURL   string
+	ctiToken string
 )
 
 // Agent Object
@@ -27,49 +31,29 @@ type Agent struct {
 	Skills  []string
 }
 
-// Call Object
-type Call struct {
-	UCID         string
-	UUI          string
-	AgentStation string
-	AgentID      string
-	Skill        string
-	VDN          string
-	ANI          string
-}
-
 // Topic struct
 type Topic struct {
-	Name string
-	Type string
+	Name   string
+	Type   string
+	Switch string
 }
 
 func init() {
-	redisHost := os.Getenv("REDIS_HOST")
-	if redisHost == "" {
-		redisHost = "redis:6379"
-	}
+	cfg, err := config.Load()
+	db.FailOnError(err, "Failed to load the configuration")
 
-	conn = db.Connect(redisHost)
+	conn = db.Connect(cfg.Redis.Host)
 
-	rabbitMQHost := os.Getenv("RABBITMQ_PORT_5672_TCP_ADDR")
-	if redisHost == "" {
-		rabbitMQHost = ":5672"
-	}
-	var err error
-	mq, err = amqp.Dial(fmt.Sprintf("amqp://guest:guest@%s:5672/", rabbitMQHost))
+	mq, err = amqp.Dial(cfg.RabbitMQ.URL())
 
 	db.FailOnError(err, "Failed to connect to RabbitMQ")
 	log.Println("RabbitMQ connected...")
 
-	extensionsAndTypes := strings.Split(os.Getenv("MONITORED_EXTENSIONS"), ",")
-	if len(extensionsAndTypes) > 1 {
-		for i := range extensionsAndTypes {
-			extensionAndType := strings.Split(extensionsAndTypes[i], ":")
-			name := strings.TrimSpace(extensionAndType[0])
-			extType := strings.TrimSpace(extensionAndType[1])
-			topics = append(topics, Topic{Name: name, Type: extType})
-		}
+	ctiURL = cfg.HTTP.URL
+	ctiToken = cfg.HTTP.Token
+
+	for _, t := range cfg.Topics() {
+		topics = append(topics, Topic{Name: t.ID, Type: t.Type, Switch: t.Switch})
 	}
 }
 
@@ -81,6 +65,14 @@ func estabilishedEvent(event string) bool {
 	return strings.HasPrefix(event, "{\"EstablishedEvent\"")
 }
 
+func transferredEvent(event string) bool {
+	return strings.HasPrefix(event, "{\"TransferredEvent\"")
+}
+
+func conferencedEvent(event string) bool {
+	return strings.HasPrefix(event, "{\"ConferencedEvent\"")
+}
+
 func agentLoggedOffEvent(event string) bool {
 	return strings.HasPrefix(event, "{\"AgentLoggedOffEvent\"")
 }
@@ -105,12 +97,13 @@ func getUCID(eventType string, json string) string {
 	return gjson.Get(json, eventType+".callLinkageData.globalCallData.globalCallLinkageID.globallyUniqueCallLinkageID").String()
 }
 
-func save(ID string, entity interface{}) {
+// save the entity, expiring after ttl unless it is 0
+func save(ID string, entity interface{}, ttl time.Duration) {
 	value, err := json.Marshal(entity)
 	if err != nil {
 		log.Printf("error while marshaling json %v\n", err)
 	}
-	if err := conn.Set(ID, value, 0).Err(); err != nil {
+	if err := conn.Set(ID, value, ttl).Err(); err != nil {
 		log.Printf("error: %v", err)
 	}
 }
@@ -137,35 +130,86 @@ func remove(ID string) error {
 	return nil
 }
 
-func addCall(event string) {
-	call := Call{
-		UCID: getUCID("DeliveredEvent", event),
-		VDN:  getExtensionNumber("DeliveredEvent.calledDevice", event),
-		ANI:  getExtensionNumber("DeliveredEvent.callingDevice", event)}
-	save(call.UCID, &call)
-	log.Printf("Call saved %v\n", call)
+func indexCall(call *db.Call) {
+	if err := db.IndexCall(conn, call); err != nil {
+		log.Printf("error while indexing call %s: %v\n", call.UCID, err)
+	}
+}
+
+func addCall(event string) *db.Call {
+	UCID := getUCID("DeliveredEvent", event)
+	var call db.Call
+	if err := find(UCID, &call); err != nil {
+		call = db.Call{
+			UCID:      UCID,
+			VDN:       getExtensionNumber("DeliveredEvent.calledDevice", event),
+			ANI:       getExtensionNumber("DeliveredEvent.callingDevice", event),
+			StartTime: time.Now()}
+		save(call.UCID, &call, db.CallRetention)
+		indexCall(&call)
+		log.Printf("Call saved %v\n", call)
+	}
+	saveCallID(gjson.Get(event, "DeliveredEvent.connection.callID").String(), call.UCID)
+	return &call
+}
+
+func screenPop(eventType string, station string, call *db.Call) {
+	if station == "" {
+		return
+	}
+	pop := *call
+	if pop.AgentID == "" {
+		var agent Agent
+		find(getAgentIDKey(station), &agent)
+		pop.AgentID = agent.ID
+	}
+	message, err := db.NewScreenPop(conn, eventType, station, &pop)
+	if err != nil {
+		log.Printf("error while loading call history for %s: %v\n", pop.ANI, err)
+	}
+	if err := db.PublishScreenPop(conn, message); err != nil {
+		log.Printf("error while publishing screen pop for %s: %v\n", station, err)
+		return
+	}
+	log.Printf("Screen pop %s sent to station %s\n", eventType, station)
 }
 
 func getAgentIDKey(station string) string {
 	return "agent-station-" + station
 }
 
-func updateCall(event string) {
-	var call Call
+func updateCall(event string) *db.Call {
+	var call db.Call
 	UCID := getUCID("EstablishedEvent", event)
 	if err := find(UCID, &call); err != nil {
 		log.Printf("%v error", err)
-		return
+		return nil
+	}
+	if data := getEstabilishedEventValue("userData.string", event); data != "" {
+		if UUI, err := uui.Decode(data); err != nil {
+			log.Printf("%v error", err)
+		} else {
+			call.UUI = UUI.Text()
+			call.UUIFields = UUI.Values()
+		}
 	}
-	UUI, _ := hex.DecodeString(getEstabilishedEventValue("userData.string", event))
-	call.UUI = string(UUI)
 	call.AgentStation = getExtensionNumber("EstablishedEvent.answeringDevice", event)
 	call.Skill = getSkill(event)
 	var agent Agent
 	find(getAgentIDKey(call.AgentStation), &agent)
 	call.AgentID = agent.ID
-	save(call.UCID, &call)
+	call.AddAgent(agent.ID)
+	call.Legs = append(call.Legs, db.CallLeg{
+		UCID:         call.UCID,
+		Event:        "Established",
+		AgentID:      call.AgentID,
+		AgentStation: call.AgentStation,
+		Time:         time.Now()})
+	save(call.UCID, &call, db.CallRetention)
+	indexCall(&call)
+	saveCallID(gjson.Get(event, "EstablishedEvent.establishedConnection.callID").String(), call.UCID)
 	log.Printf("Call updated %v\n", call)
+	return &call
 }
 
 func getSkill(event string) string {
@@ -186,7 +230,7 @@ func addAgent(event string) {
 	} else {
 		agent.Skills = append(agent.Skills, skill)
 	}
-	save(getAgentIDKey(agent.Station), agent)
+	save(getAgentIDKey(agent.Station), agent, 0)
 	log.Printf("Agent added %v\n", agent)
 }
 
@@ -245,26 +289,39 @@ func createConsumer(queue string) (<-chan amqp.Delivery, *amqp.Channel, error) {
 	return events, ch, err
 }
 
-func monitoringVDN(vdn string) (*amqp.Channel, error) {
-	events, channel, err := createConsumer(vdn)
+func monitoringVDN(switchName string, vdn string) (*amqp.Channel, error) {
+	events, channel, err := createConsumer(helper.GetExchangeName(switchName, vdn))
 
 	go func() {
 		for e := range events {
 			event := string(e.Body)
 			switch {
 			case deliveredEvent(event):
-				addCall(event)
+				call := addCall(event)
+				screenPop("Delivered", getExtensionNumber("DeliveredEvent.alertingDevice", event), call)
 			case estabilishedEvent(event):
-				updateCall(event)
+				if call := updateCall(event); call != nil {
+					screenPop("Established", call.AgentStation, call)
+				}
+			case transferredEvent(event):
+				linkCalls("TransferredEvent", "transferringDevice", "transferredConnections", event)
+			case conferencedEvent(event):
+				linkCalls("ConferencedEvent", "conferencingDevice", "conferenceConnections", event)
+			case snapshotEvent(event):
+				seedCalls(vdn, event)
 			}
 		}
 	}()
 
+	requestSnapshot(switchName, vdn)
+
 	return channel, err
 }
 
-func monitoringSkill(skill string) error {
-	events, channel, err := createConsumer(skill)
+// monitoringSkill keeps the agent records of the skill from its logon events, without snapshot:
+// the agents logged on while the consumer was stopped are recorded on their next logon
+func monitoringSkill(switchName string, skill string) error {
+	events, channel, err := createConsumer(helper.GetExchangeName(switchName, skill))
 	go func() {
 		defer channel.Close()
 		for e := range events {
@@ -287,9 +344,9 @@ func messageHandler(topics []Topic) {
 		log.Printf("Handling messages for %v\n", t)
 		switch t.Type {
 		case "SKILL":
-			monitoringSkill(t.Name)
+			monitoringSkill(t.Switch, t.Name)
 		case "VDN":
-			monitoringVDN(t.Name)
+			monitoringVDN(t.Switch, t.Name)
 		}
 	}
 }
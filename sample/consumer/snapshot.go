@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	db "github.com/rresender/csta-integration/sample/common"
+	"github.com/tidwall/gjson"
+)
+
+func snapshotEvent(event string) bool {
+	return strings.HasPrefix(event, "{\"SnapshotEvent\"")
+}
+
+func getDeviceNumber(device string) string {
+	return strings.Split(device, ":")[0]
+}
+
+// requestSnapshot asks the cti service to publish the calls in progress on the extension of the switch
+func requestSnapshot(switchName string, extension string) {
+	if ctiURL == "" {
+		return
+	}
+	req, err := http.NewRequest(http.MethodGet, ctiURL+"/snapshot/"+url.PathEscape(extension)+"?"+url.Values{"switch": {switchName}}.Encode(), nil)
+	if err != nil {
+		log.Printf("snapshot of %s could not be requested: %v\n", extension, err)
+		return
+	}
+	if ctiToken != "" {
+		req.Header.Set("Authorization", "Bearer "+ctiToken)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("snapshot of %s could not be requested: %v\n", extension, err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		log.Printf("snapshot of %s on %s could not be requested: %s %s\n", extension, switchName, resp.Status, strings.TrimSpace(string(message)))
+	}
+}
+
+// seedCalls restores the calls in progress on the VDN from a snapshot, their agents are taken from the
+// agent records of the stations connected to the calls. The agent records themselves are not seeded:
+// a snapshot does not report the agents logged on to a skill, only their AgentLoggedOn events do.
+func seedCalls(vdn string, event string) {
+	calls := gjson.Get(event, "SnapshotEvent.Calls").Array()
+	for _, c := range calls {
+		UCID := c.Get("UCID").String()
+		if UCID == "" {
+			log.Printf("call %s of the snapshot of %s has no UCID\n", c.Get("CallID").String(), vdn)
+			continue
+		}
+		var call db.Call
+		if err := find(UCID, &call); err != nil {
+			call = db.Call{
+				UCID:      UCID,
+				VDN:       vdn,
+				ANI:       getDeviceNumber(c.Get("CallingDevice").String()),
+				StartTime: time.Now()}
+		}
+		for _, d := range c.Get("Devices").Array() {
+			station := getDeviceNumber(d.Get("Device").String())
+			if d.Get("State").String() != "connected" || station == call.ANI || station == vdn || station == call.AgentStation {
+				continue
+			}
+			var agent Agent
+			if err := find(getAgentIDKey(station), &agent); err != nil {
+				log.Printf("station %s of the call %s has no agent record, its agent logged on before the consumer started\n", station, UCID)
+			}
+			call.AgentStation = station
+			call.AgentID = agent.ID
+			call.AddAgent(agent.ID)
+			call.Legs = append(call.Legs, db.CallLeg{
+				UCID:         call.UCID,
+				Event:        "Snapshot",
+				AgentID:      call.AgentID,
+				AgentStation: call.AgentStation,
+				Time:         time.Now()})
+		}
+		save(call.UCID, &call, db.CallRetention)
+		indexCall(&call)
+		saveCallID(c.Get("CallID").String(), call.UCID)
+		log.Printf("Call seeded %v\n", call)
+	}
+	log.Printf("%d calls in progress seeded from the snapshot of %s\n", len(calls), vdn)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	db "github.com/rresender/csta-integration/sample/common"
+	"github.com/tidwall/gjson"
+)
+
+// callIDTTL how long a CSTA callID is correlated to its UCID
+const callIDTTL = 24 * time.Hour
+
+func getCallIDKey(callID string) string {
+	return "call-id-" + callID
+}
+
+func saveCallID(callID string, UCID string) {
+	if callID == "" || UCID == "" {
+		return
+	}
+	if err := conn.Set(getCallIDKey(callID), UCID, callIDTTL).Err(); err != nil {
+		log.Printf("error: %v", err)
+	}
+}
+
+func findUCIDByCallID(callID string) string {
+	if callID == "" {
+		return ""
+	}
+	UCID, _ := conn.Get(getCallIDKey(callID)).Result()
+	return UCID
+}
+
+func getNewCallIDs(path string, event string) []string {
+	callIDs := []string{}
+	items := gjson.Get(event, path+".connectionListItem")
+	if !items.IsArray() {
+		items = gjson.Parse("[" + items.Raw + "]")
+	}
+	for _, item := range items.Array() {
+		if callID := item.Get("newConnection.callID").String(); callID != "" {
+			callIDs = db.AppendUnique(callIDs, callID)
+		}
+	}
+	return callIDs
+}
+
+// linkCalls merges the old calls of a Transferred or Conferenced event into the resulting call
+func linkCalls(eventType string, devicePath string, connectionsPath string, event string) {
+	primary := findUCIDByCallID(gjson.Get(event, eventType+".primaryOldCall.callID").String())
+	secondary := findUCIDByCallID(gjson.Get(event, eventType+".secondaryOldCall.callID").String())
+	resulting, UCIDs := db.TransferUCIDs(
+		gjson.Get(event, eventType+".callLinkageDataList.newCallLinkageData.globalCallData.globalCallLinkageID.globallyUniqueCallLinkageID").String(),
+		primary, secondary)
+	if resulting == "" {
+		log.Printf("%s could not be correlated to a known call\n", eventType)
+		return
+	}
+
+	calls := []*db.Call{}
+	for _, UCID := range UCIDs {
+		var call db.Call
+		if err := find(UCID, &call); err != nil {
+			call = db.Call{UCID: UCID, StartTime: time.Now()}
+		}
+		calls = append(calls, &call)
+	}
+	result := calls[0]
+	db.MergeCalls(result, calls)
+
+	station := getExtensionNumber(eventType+"."+devicePath, event)
+	var agent Agent
+	find(getAgentIDKey(station), &agent)
+	result.AddAgent(agent.ID)
+	result.Legs = append(result.Legs, db.CallLeg{
+		UCID:         resulting,
+		Event:        eventType,
+		AgentID:      agent.ID,
+		AgentStation: station,
+		Time:         time.Now()})
+
+	for _, call := range calls {
+		save(call.UCID, call, db.CallRetention)
+		indexCall(call)
+	}
+	for _, callID := range getNewCallIDs(eventType+"."+connectionsPath, event) {
+		saveCallID(callID, resulting)
+	}
+	log.Printf("%s linked calls %v into %s\n", eventType, UCIDs, resulting)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/rresender/csta-integration/cti/auth"
+	db "github.com/rresender/csta-integration/sample/common"
+)
+
+// authenticator of the API, disabled without API keys and JWT secret
+var authenticator *auth.Authenticator
+
+func readOnly(r *http.Request) []auth.Role {
+	return []auth.Role{auth.ReadOnly}
+}
+
+// requestExtension of the screen pop routes, the access to the calls is checked against their devices
+func requestExtension(r *http.Request) string {
+	return mux.Vars(r)["key"]
+}
+
+// authorize every request of the API for the read-only role
+func authorize(next http.Handler) http.Handler {
+	return authenticator.Handler(readOnly, requestExtension, next)
+}
+
+// canAccessCall when the identity of the request is allowed one of the devices of the call
+func canAccessCall(r *http.Request, call *db.Call) bool {
+	identity := auth.FromContext(r.Context())
+	if identity.CanAccess(call.VDN, call.Skill, call.AgentStation) {
+		return true
+	}
+	for _, leg := range call.Legs {
+		if identity.CanAccess(leg.AgentStation) {
+			return true
+		}
+	}
+	return false
+}
+
+// canSearchCalls requires the identities restricted to some extensions to search by one of them
+func canSearchCalls(r *http.Request, query db.CallQuery) bool {
+	identity := auth.FromContext(r.Context())
+	if !identity.Restricted() {
+		return true
+	}
+	return (query.VDN != "" || query.Skill != "") &&
+		(query.VDN == "" || identity.CanAccess(query.VDN)) && (query.Skill == "" || identity.CanAccess(query.Skill))
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	db "github.com/rresender/csta-integration/sample/common"
+)
+
+const (
+	screenPopWriteWait  = 10 * time.Second
+	screenPopPongWait   = 60 * time.Second
+	screenPopPingPeriod = screenPopPongWait * 9 / 10
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+// screenPopHandler streams the screen pops of a redis channel to a websocket session
+func screenPopHandler(channel func(key string) string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		key := mux.Vars(r)["key"]
+
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Printf("error while upgrading screen pop session for %s: %v\n", key, err)
+			return
+		}
+		defer ws.Close()
+
+		pubsub := conn.Subscribe(channel(key))
+		defer pubsub.Close()
+
+		log.Printf("Screen pop session opened for %s\n", key)
+
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			ws.SetReadDeadline(time.Now().Add(screenPopPongWait))
+			ws.SetPongHandler(func(string) error {
+				return ws.SetReadDeadline(time.Now().Add(screenPopPongWait))
+			})
+			for {
+				if _, _, err := ws.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		ping := time.NewTicker(screenPopPingPeriod)
+		defer ping.Stop()
+
+		messages := pubsub.Channel()
+		for {
+			select {
+			case message := <-messages:
+				ws.SetWriteDeadline(time.Now().Add(screenPopWriteWait))
+				if err := ws.WriteMessage(websocket.TextMessage, []byte(message.Payload)); err != nil {
+					log.Printf("error while sending screen pop to %s: %v\n", key, err)
+					return
+				}
+			case <-ping.C:
+				ws.SetWriteDeadline(time.Now().Add(screenPopWriteWait))
+				if err := ws.WriteMessage(websocket.PingMessage, nil); err != nil {
+					return
+				}
+			case <-closed:
+				log.Printf("Screen pop session closed for %s\n", key)
+				return
+			}
+		}
+	}
+}
+
+func screenPopRoutes(m *mux.Router) {
+	m.HandleFunc("/screenpop/agent/{key}", screenPopHandler(db.GetAgentScreenPopChannel))
+	m.HandleFunc("/screenpop/station/{key}", screenPopHandler(db.GetStationScreenPopChannel))
+}
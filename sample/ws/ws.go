@@ -1,13 +1,17 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/go-redis/redis"
 	"github.com/gorilla/mux"
+	"github.com/rresender/csta-integration/cti/config"
 	db "github.com/rresender/csta-integration/sample/common"
 )
 
@@ -15,11 +19,62 @@ var conn *redis.Client
 var port = ":7070"
 
 func init() {
-	redisHost := os.Getenv("REDIS_HOST")
-	if redisHost == "" {
-		redisHost = "redis:6379"
+	cfg, err := config.Load()
+	db.FailOnError(err, "Failed to load the configuration")
+
+	authenticator, err = cfg.Auth.Authenticator()
+	db.FailOnError(err, "Failed to configure the authentication")
+	if !authenticator.Enabled() {
+		log.Println("The API is not authenticated: configure API keys or a JWT secret")
+	}
+
+	conn = db.Connect(cfg.Redis.Host)
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func parseCallQuery(r *http.Request) (db.CallQuery, error) {
+	values := r.URL.Query()
+	query := db.CallQuery{
+		ANI:     values.Get("ani"),
+		AgentID: values.Get("agent"),
+		VDN:     values.Get("vdn"),
+		Skill:   values.Get("skill"),
+		UUI:     values.Get("uui"),
+	}
+	var err error
+	if query.From, err = parseTime(values.Get("from")); err != nil {
+		return query, fmt.Errorf("invalid from: %v", err)
+	}
+	if query.To, err = parseTime(values.Get("to")); err != nil {
+		return query, fmt.Errorf("invalid to: %v", err)
+	}
+	if v := values.Get("offset"); v != "" {
+		if query.Offset, err = strconv.Atoi(v); err != nil {
+			return query, fmt.Errorf("invalid offset: %v", err)
+		}
+	}
+	if v := values.Get("limit"); v != "" {
+		if query.Limit, err = strconv.Atoi(v); err != nil {
+			return query, fmt.Errorf("invalid limit: %v", err)
+		}
+	}
+	return query, nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("error while encoding response: %v\n", err)
 	}
-	conn = db.Connect(redisHost)
 }
 
 func main() {
@@ -27,6 +82,7 @@ func main() {
 	defer conn.Close()
 
 	m := mux.NewRouter()
+	m.Use(authorize)
 
 	m.HandleFunc("/callinfo/{ucid}", func(w http.ResponseWriter, r *http.Request) {
 
@@ -44,10 +100,76 @@ func main() {
 			return
 		}
 
+		var call db.Call
+		if json.Unmarshal([]byte(js.Val()), &call) != nil || !canAccessCall(r, &call) {
+			http.Error(w, fmt.Sprintf("Call %s is not allowed", UCID), http.StatusForbidden)
+			return
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		w.Write([]byte(js.Val()))
 	})
 
+	m.HandleFunc("/calls", func(w http.ResponseWriter, r *http.Request) {
+
+		query, err := parseCallQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !canSearchCalls(r, query) {
+			http.Error(w, "Calls must be searched by an allowed vdn or skill", http.StatusForbidden)
+			return
+		}
+
+		page, err := db.SearchCalls(conn, query)
+		if err != nil {
+			log.Printf("error while searching calls: %v\n", err)
+			http.Error(w, "Call history is not available", http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, page)
+	}).Methods(http.MethodGet)
+
+	m.HandleFunc("/calls/{ucid}", func(w http.ResponseWriter, r *http.Request) {
+
+		UCID := mux.Vars(r)["ucid"]
+
+		call, err := db.FindCall(conn, UCID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("No Call found for UCID: %s", UCID), http.StatusNotFound)
+			return
+		}
+		if !canAccessCall(r, call) {
+			http.Error(w, fmt.Sprintf("Call %s is not allowed", UCID), http.StatusForbidden)
+			return
+		}
+
+		writeJSON(w, call)
+	}).Methods(http.MethodGet)
+
+	m.HandleFunc("/calls/{ucid}/cdr", func(w http.ResponseWriter, r *http.Request) {
+
+		UCID := mux.Vars(r)["ucid"]
+
+		call, err := db.FindCall(conn, UCID)
+		if err == nil && !canAccessCall(r, call) {
+			http.Error(w, fmt.Sprintf("Call %s is not allowed", UCID), http.StatusForbidden)
+			return
+		}
+
+		cdr, err := db.BuildCDR(conn, UCID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("No Call found for UCID: %s", UCID), http.StatusNotFound)
+			return
+		}
+
+		writeJSON(w, cdr)
+	}).Methods(http.MethodGet)
+
+	screenPopRoutes(m)
+
 	log.Printf("HTTP Server Listening at %s\n", port)
 	log.Fatal(http.ListenAndServe(port, m))
 }